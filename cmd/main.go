@@ -9,6 +9,7 @@ import (
 	"github.com/gocarina/gocsv"
 	"github.com/greggyNapalm/proxychick/pkg/client"
 	"github.com/greggyNapalm/proxychick/pkg/job"
+	"github.com/greggyNapalm/proxychick/pkg/judge"
 	"github.com/greggyNapalm/proxychick/pkg/stat"
 	"github.com/greggyNapalm/proxychick/pkg/utils"
 	"github.com/oschwald/geoip2-golang"
@@ -19,8 +20,11 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -33,19 +37,63 @@ var (
 	debug   = false
 )
 
+// Repeatable string flag.
+type strListFlag []string
+
+func (l *strListFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *strListFlag) Set(val string) error {
+	*l = append(*l, val)
+	return nil
+}
+
 type CmdCfg struct {
 	maxConcurrency      int
-	targetURL           *url.URL
-	targetAddr          string
+	targets             []job.TargetCfg
+	targetsPath         string
 	inPath              string
 	outPath             string
 	isPorgresBarEnabled bool
 	isStatsEnables      bool
 	prxProto            string
 	timeOut             time.Duration
+	httpTimeouts        client.HTTPTimeouts
 	loop                int
 	transport           string
 	countryMmdbPath     string
+	asnMmdbPath         string
+	groupBy             string
+	groupLayout         string
+	proxyMode           string
+	proxyTLS            client.TLSCfg
+	targetTLS           client.TLSCfg
+	configPath          string
+	request             client.HTTPRequestCfg
+	validation          client.ValidationCfg
+	detectBlocks        bool
+	blockRulesPath      string
+	redirects           client.RedirectPolicy
+	bandwidth           *client.BandwidthCfg
+	judgeAddr           string
+	pricePerGB          float64
+	maxBytes            int64
+	tunnel              *client.TunnelTestOpts
+	judgeEchoAddr       string
+	keepAlive           int
+	tcpProbe            client.TCPProbeCfg
+	portAudit           *client.PortAuditOpts
+	judgeEchoPorts      []int
+	ssrfAudit           *client.SSRFAuditOpts
+	judgeCanaryAddr     string
+	authCheck           bool
+	udpStream           *client.UDPStreamCfg
+	udpProbe            *client.UDPProbeCfg
+	udpMTU              *client.UDPMTUCfg
+	retry               *job.RetryCfg
+	rps                 *job.RPSCfg
+	judgeUDPEchoAddr    string
 }
 
 func NewCmdCfg() CmdCfg {
@@ -56,18 +104,162 @@ func NewCmdCfg() CmdCfg {
 	flag.IntVar(&rv.maxConcurrency, "c", 300, "number of simultaneous HTTP requests(maxConcurrency)")
 	flag.StringVar(&rv.inPath, "i", "proxylist.txt", "path to the proxylist file or STDIN")
 	flag.StringVar(&rv.outPath, "o", "STDOUT", "path to the results file")
-	flag.StringVar(&rv.prxProto, "p", "http", "Proxy protocol. If not specified in proxy URL, choose one of http/https/socks4/socks4a/socks5/socks5h")
-	var timeOut = flag.String("to", "10s", "Timeout for entire request")
+	flag.StringVar(&rv.prxProto, "p", "http", "Proxy protocol. If not specified in proxy URL, choose one of http/https/socks4/socks4a/socks5/socks5h or auto to detect it for each proxy")
+	var timeOut = flag.String("to", "10s", "Timeout for entire request, also the default of each -to* budget of the HTTP checker")
+	flag.DurationVar(&rv.httpTimeouts.Connect, "toConnect", 0, "Budget of TCP connection and TLS handshake to the proxy, 0 means -to")
+	flag.DurationVar(&rv.httpTimeouts.ProxyResp, "toProxy", 0, "Budget of the proxy CONNECT or SOCKS reply, 0 means -to")
+	flag.DurationVar(&rv.httpTimeouts.TLS, "toTLS", 0, "Budget of TLS handshake with the target, 0 means -to")
+	flag.DurationVar(&rv.httpTimeouts.TTFB, "toTTFB", 0, "Budget of the first reply byte since the request start, 0 means -to")
+	flag.DurationVar(&rv.httpTimeouts.Total, "toTotal", 0, "Budget of the whole request including the body, 0 means -to")
+	var retries = flag.Int("retries", 0, "Retry the failed test up to N times, every attempt is reported")
+	var retryBackoff = flag.Duration("retryBackoff", 200*time.Millisecond, "Pause before the first retry, doubled before each next one")
+	var retryBackoffMax = flag.Duration("retryBackoffMax", 5*time.Second, "Longest pause btw retries, 0 means no limit")
+	var retryOn = flag.String("retryOn", strings.Join(job.DefaultRetryOn, ","), "Comma separated error categories to retry on: "+strings.Join(job.ErrCategories, ", "))
 	flag.IntVar(&rv.loop, "loop", 1, "Loop over proxylist content N times")
+	var rps = flag.String("rps", "", "Start tests by the request rate schedule instead of -c, e.g. \"const(100,5m)\", \"line(10,500,10m)\" or \"step(10,100,10,1m)\", segments are space separated. Proxy × target pairs are taken in turn until the schedule is over")
+	var rpsMaxInFlight = flag.Int("rpsMaxInFlight", job.DefaultMaxInFlight, "Tests running at once with -rps, the schedule lags behind once it's reached")
 	flag.StringVar(&rv.transport, "transport", "tcp", "Transport protocol for interaction with the target. Will be incapsulated into proxy protocol.")
 	var pBarDisabled = flag.Bool("noProgresBar", false, "Disable the progress meter")
 	var statDisabled = flag.Bool("noStat", false, "Disable stats output")
-	var targetAddr = flag.String("t", defaultTCPTarget, "Target URL(TCP) and HOST:PORT(UDP)")
+	var targetAddrs strListFlag
+	flag.Var(&targetAddrs, "t", "Target URL(TCP) and HOST:PORT(UDP), can be repeated to test every proxy against each target (default \""+defaultTCPTarget+"\")")
+	flag.StringVar(&rv.targetsPath, "targets", "", "Path to the file with target URLs, one per line")
 	var showVersion = flag.Bool("version", false, "Show version and exit")
 	var debugCmd = flag.Bool("verbose", false, "Enables debug logs")
 	flag.StringVar(&rv.countryMmdbPath, "countryMmdb", "", "Path to GeoLite2-Country.mmdb")
+	flag.StringVar(&rv.asnMmdbPath, "asnMmdb", "", "Path to GeoLite2-ASN.mmdb")
+	flag.StringVar(&rv.proxyMode, "proxyMode", client.ProxyModeAuto, "How HTTP(S) proxy reaches the target: forward(absolute-URI request), connect(CONNECT tunnel) or auto(forward for http:// and connect for https:// targets)")
+	flag.StringVar(&rv.groupBy, "groupBy", "", "Break stats down by one of "+strings.Join(stat.GroupByDimensions, "/"))
+	flag.StringVar(&rv.groupLayout, "groupLayout", "tables", "Grouped stats layout: tables(all tables per group) or pivot(groups as rows)")
+	flag.StringVar(&rv.configPath, "config", "", "Path to YAML config file, flags take precedence over it")
+	flag.StringVar(&rv.request.Method, "method", "", "HTTP request method (default GET)")
+	var headers, userAgents strListFlag
+	flag.Var(&headers, "H", "HTTP request header \"Name: value\", can be repeated. Host header overrides the request Host")
+	flag.StringVar(&rv.request.Body, "body", "", "HTTP request body")
+	flag.StringVar(&rv.request.BodyFile, "bodyFile", "", "Path to the file with HTTP request body")
+	flag.Var(&userAgents, "ua", "User-Agent, can be repeated to rotate them randomly")
+	flag.StringVar(&rv.request.UserAgentsFile, "uaFile", "", "Path to the file with User-Agents to rotate, one per line")
+	var expectStatus = flag.String("expectStatus", "", "Comma separated list of valid target status codes")
+	flag.StringVar(&rv.validation.BodyRegex, "expectBody", "", "Regex valid target response body has to match")
+	var expectJSON = flag.String("expectJSON", "", "JSON path and value valid target response body has to contain, e.g. data.country=US")
+	flag.Int64Var(&rv.validation.MaxBodySize, "maxBodySize", 0, "Max size of valid target response body in bytes")
+	var expectHeaders strListFlag
+	flag.Var(&expectHeaders, "expectHeader", "Header valid target response has to contain \"Name\" or \"Name: regex\", can be repeated")
+	flag.BoolVar(&rv.detectBlocks, "detectBlocks", false, "Label target responses as ok/blocked/captcha with the built-in rules")
+	flag.StringVar(&rv.blockRulesPath, "blockRules", "", "Path to YAML file with block/captcha rules, checked before the built-in ones. Enables detectBlocks")
+	flag.IntVar(&rv.redirects.MaxHops, "redirects", 0, "Follow up to N redirects of the target recording each hop, 0 disables following")
+	flag.BoolVar(&rv.redirects.SameHost, "redirectSameHost", false, "Follow only redirects to the target host")
+	var bandwidth = flag.Bool("bandwidth", false, "Download the whole target reply through each proxy and measure throughput")
+	var upload = flag.String("upload", "", "Upload payload of this size(e.g. 10MB) as the request body in bandwidth mode. Enables bandwidth")
+	flag.Float64Var(&rv.pricePerGB, "pricePerGB", 0, "Traffic price per GB(1024^3 bytes) to estimate the cost of the run")
+	var maxBytes = flag.String("maxBytes", "", "Traffic budget(e.g. 500MB), no new tests are started once it is exceeded. Tests in flight are finished, so the budget can be overrun by up to -c(-rpsMaxInFlight with -rps) tests")
+	var tcpPayload = flag.String("tcpPayload", "", "Payload sent to tcp://HOST:PORT targets, Go escapes are supported, e.g. \"PING\\r\\n\"")
+	flag.StringVar(&rv.tcpProbe.Expect, "tcpExpect", "", "Regex the reply of tcp://HOST:PORT targets has to match, e.g. \"^220 \" or \"^SSH-2.0-\"")
+	flag.IntVar(&rv.keepAlive, "keepAlive", 0, "Send N sequential requests over one proxied connection to measure warm latency, 0 disables")
+	flag.StringVar(&rv.judgeAddr, "judge", "", "Run the judge server on HOST:PORT instead of testing, it serves /bytes/{size}, /upload and /ip")
+	flag.StringVar(&rv.judgeEchoAddr, "judgeEcho", "", "Run TCP echo server of the judge on HOST:PORT, e.g. for the tunnel test")
+	var judgeEchoPorts = flag.String("judgeEchoPorts", "", "Comma separated list of extra ports the judge TCP echo listens on, on the host of judgeEcho, e.g. for the port audit")
+	var portAudit = flag.String("portAudit", "", "Comma separated list of destination ports to try through each proxy against the multi-port echo target(-t tcp://HOST), e.g. 22,25,80,443,8080,5222")
+	flag.StringVar(&rv.judgeCanaryAddr, "judgeCanary", "", "Run SSRF canary of the judge on HOST:PORT, it replies to any request with the canary marker")
+	var ssrfAudit = flag.Bool("ssrfAudit", false, "Check each proxy can't reach the targets(loopback, RFC1918 and metadata addresses by default) with CONNECT/SOCKS tunnel and forward request")
+	flag.BoolVar(&rv.authCheck, "authCheck", false, "Also probe each proxy with credentials without them and with the wrong password, both have to be rejected")
+	flag.StringVar(&rv.judgeUDPEchoAddr, "judgeUDPEcho", "", "Run UDP echo server of the judge on HOST:PORT, e.g. for the UDP quality mode")
+	var udpStream = flag.Int("udpStream", 0, "UDP quality mode: send N sequenced datagrams through each proxy to the echo target and measure loss, jitter and reordering, 0 disables")
+	var udpRate = flag.Int("udpRate", 50, "Datagrams per second in UDP quality mode")
+	var udpSize = flag.Int("udpSize", 160, "Payload bytes of each datagram in UDP quality mode")
+	var udpProbe = flag.String("udpProbe", client.UDPProbeEcho, "UDP probe sent through each proxy: "+strings.Join(client.UDPProbes, ", ")+". DNS, STUN and NTP probes use public servers unless the target is given")
+	var udpDNSName = flag.String("udpDNSName", "example.com", "Name the DNS UDP probe resolves")
+	var udpMTU = flag.Int("udpMTU", 0, "Binary-search the largest datagram each proxy relays to the echo target and back intact, up to N bytes(e.g. 1472, "+strconv.Itoa(client.UDPMaxDatagram)+" at most), 0 disables")
+	var udpMTUProbeTo = flag.Duration("udpMTUProbeTo", 0, "Echo await of each datagram size the -udpMTU search sends after the smallest one, 0 means -to")
+	var tunnelDuration = flag.Duration("tunnel", 0, "Keep a tunnel to the echo target(-t tcp://HOST:PORT) open through each proxy for this long, exchanging heartbeats")
+	var heartbeatInterval = flag.Duration("heartbeat", time.Second, "Interval btw the tunnel test heartbeats")
+	for _, leg := range []struct {
+		name string
+		cfg  *client.TLSCfg
+	}{{"proxy", &rv.proxyTLS}, {"target", &rv.targetTLS}} {
+		flag.StringVar(&leg.cfg.CAFile, leg.name+"CA", "", "Path to PEM CA bundle to verify the "+leg.name+" TLS certificate")
+		flag.BoolVar(&leg.cfg.Insecure, leg.name+"Insecure", false, "Skip verification of the "+leg.name+" TLS certificate")
+		flag.StringVar(&leg.cfg.SNI, leg.name+"SNI", "", "Override SNI(ServerName) sent to the "+leg.name)
+		flag.StringVar(&leg.cfg.CertFile, leg.name+"Cert", "", "Path to PEM client certificate for mTLS with the "+leg.name)
+		flag.StringVar(&leg.cfg.KeyFile, leg.name+"Key", "", "Path to PEM client key for mTLS with the "+leg.name)
+	}
 	flag.Parse()
 
+	for _, h := range headers {
+		name, val, ok := strings.Cut(h, ":")
+		if !ok {
+			log.Fatal("Can't parse header(H) cmd param:" + h)
+		}
+		if rv.request.Headers == nil {
+			rv.request.Headers = make(map[string]string)
+		}
+		rv.request.Headers[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	rv.request.UserAgents = userAgents
+	if *expectStatus != "" {
+		for _, code := range strings.Split(*expectStatus, ",") {
+			codeInt, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				log.Fatal("Can't parse expectStatus cmd param:" + *expectStatus)
+			}
+			rv.validation.StatusCodes = append(rv.validation.StatusCodes, codeInt)
+		}
+	}
+	if *expectJSON != "" {
+		path, val, ok := strings.Cut(*expectJSON, "=")
+		if !ok {
+			log.Fatal("Can't parse expectJSON cmd param:" + *expectJSON)
+		}
+		rv.validation.JSONPath, rv.validation.JSONValue = path, val
+	}
+	for _, h := range expectHeaders {
+		name, expr, _ := strings.Cut(h, ":")
+		if rv.validation.Headers == nil {
+			rv.validation.Headers = make(map[string]string)
+		}
+		rv.validation.Headers[strings.TrimSpace(name)] = strings.TrimSpace(expr)
+	}
+	if *tcpPayload != "" {
+		if rv.tcpProbe.Payload, err = strconv.Unquote("\"" + *tcpPayload + "\""); err != nil {
+			log.Fatal("Can't parse tcpPayload cmd param:" + *tcpPayload)
+		}
+	}
+	if rv.configPath != "" {
+		fileCfg, err := job.LoadFileCfg(rv.configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rv.request = fileCfg.Request.Merge(rv.request)
+		rv.validation = fileCfg.Validation.Merge(rv.validation)
+		rv.tcpProbe = fileCfg.TCP.Merge(rv.tcpProbe)
+		rv.targets = fileCfg.Targets
+	}
+	for _, targetAddr := range targetAddrs {
+		rv.targets = append(rv.targets, job.TargetCfg{URL: targetAddr})
+	}
+	if rv.targetsPath != "" {
+		for _, targetAddr := range GetProxyStrings(rv.targetsPath) {
+			if targetAddr = strings.TrimSpace(targetAddr); targetAddr != "" && !strings.HasPrefix(targetAddr, "#") {
+				rv.targets = append(rv.targets, job.TargetCfg{URL: targetAddr})
+			}
+		}
+	}
+	if err := rv.request.Load(); err != nil {
+		log.Fatal(err)
+	}
+	if *bandwidth || *upload != "" {
+		rv.bandwidth = &client.BandwidthCfg{}
+		if *upload != "" {
+			if rv.bandwidth.Upload, err = utils.ParseSize(*upload); err != nil {
+				log.Fatal("Can't parse upload cmd param:" + err.Error())
+			}
+		}
+	}
+	if *maxBytes != "" {
+		if rv.maxBytes, err = utils.ParseSize(*maxBytes); err != nil {
+			log.Fatal("Can't parse maxBytes cmd param:" + err.Error())
+		}
+	}
 	rv.timeOut, err = time.ParseDuration(*timeOut)
 	if err != nil {
 		log.Fatal("Can't parse timeout(to) cmd param:" + err.Error())
@@ -82,26 +274,102 @@ func NewCmdCfg() CmdCfg {
 	if *debugCmd || debugEnv != "" {
 		debug = true
 	}
-	if rv.transport == "tcp" {
-		targetURL, err := url.Parse(*targetAddr)
+	if *tunnelDuration > 0 {
+		if len(rv.targets) == 0 {
+			log.Fatal("Tunnel test requires the echo target, e.g. -t tcp://judge.example.com:7")
+		}
+		if *heartbeatInterval <= 0 || *heartbeatInterval >= *tunnelDuration {
+			log.Fatal("heartbeat has to be positive and shorter than tunnel duration")
+		}
+		rv.tunnel = &client.TunnelTestOpts{Duration: *tunnelDuration, Interval: *heartbeatInterval}
+	}
+	if *portAudit != "" {
+		if len(rv.targets) == 0 {
+			log.Fatal("Port audit requires the multi-port echo target, e.g. -t tcp://judge.example.com")
+		}
+		ports, err := utils.ParsePorts(*portAudit)
 		if err != nil {
-			log.Fatal("Can't parse Target URL:" + *targetAddr)
-			panic(err)
+			log.Fatal("Can't parse portAudit cmd param:" + err.Error())
+		}
+		rv.portAudit = &client.PortAuditOpts{Ports: ports}
+	}
+	if *judgeEchoPorts != "" {
+		if rv.judgeEchoPorts, err = utils.ParsePorts(*judgeEchoPorts); err != nil {
+			log.Fatal("Can't parse judgeEchoPorts cmd param:" + err.Error())
+		}
+	}
+	if *udpStream > 0 {
+		if *udpRate < 1 {
+			log.Fatal("udpRate has to be positive")
+		}
+		rv.udpStream = &client.UDPStreamCfg{Count: *udpStream, Rate: *udpRate, Size: *udpSize}
+	}
+	if *udpMTU > 0 {
+		if *udpMTU < client.UDPMTUMinSize || *udpMTU > client.UDPMaxDatagram {
+			log.Fatal("udpMTU has to be btw " + strconv.Itoa(client.UDPMTUMinSize) + " and " + strconv.Itoa(client.UDPMaxDatagram))
+		}
+		if *udpMTUProbeTo < 0 {
+			log.Fatal("udpMTUProbeTo can't be negative")
+		}
+		rv.udpMTU = &client.UDPMTUCfg{Max: *udpMTU, ProbeTimeout: *udpMTUProbeTo}
+	}
+	if !slices.Contains(client.UDPProbes, *udpProbe) {
+		log.Fatal("Unsupported udpProbe: " + *udpProbe)
+	}
+	if *udpProbe != client.UDPProbeEcho {
+		if rv.transport != "udp" {
+			log.Fatal("udpProbe " + *udpProbe + " requires -transport udp")
+		}
+		if len(rv.targets) == 0 {
+			rv.targets = []job.TargetCfg{{URL: client.DefaultUDPProbeTargets[*udpProbe]}}
+		}
+		rv.udpProbe = &client.UDPProbeCfg{Type: *udpProbe, DNSName: *udpDNSName}
+	}
+	if *retries > 0 {
+		rv.retry = &job.RetryCfg{Retries: *retries, Backoff: *retryBackoff, MaxBackoff: *retryBackoffMax}
+		for _, category := range strings.Split(*retryOn, ",") {
+			if !slices.Contains(job.ErrCategories, category) {
+				log.Fatal("Unsupported retryOn error category: " + category)
+			}
+			rv.retry.On = append(rv.retry.On, category)
+		}
+	}
+	if *rps != "" {
+		schedule, err := job.ParseRPSSchedule(*rps)
+		if err != nil {
+			log.Fatal("Can't parse rps cmd param:" + err.Error())
+		}
+		if *rpsMaxInFlight < 1 {
+			log.Fatal("rpsMaxInFlight has to be positive")
+		}
+		rv.rps = &job.RPSCfg{Schedule: schedule, MaxInFlight: *rpsMaxInFlight}
+	}
+	if *ssrfAudit {
+		if len(rv.targets) == 0 {
+			for _, targetAddr := range client.DefaultSSRFTargets {
+				rv.targets = append(rv.targets, job.TargetCfg{URL: targetAddr})
+			}
 		}
-		rv.targetURL = targetURL
-	} else if rv.transport == "udp" {
-		if *targetAddr == defaultTCPTarget {
-			rv.targetAddr = defaultUDPTarget
+		rv.ssrfAudit = &client.SSRFAuditOpts{}
+	}
+	if len(rv.targets) == 0 {
+		if rv.transport == "udp" {
+			rv.targets = []job.TargetCfg{{URL: defaultUDPTarget}}
 		} else {
-			rv.targetAddr = *targetAddr
+			rv.targets = []job.TargetCfg{{URL: defaultTCPTarget}}
 		}
+	}
+	if rv.transport == "udp" {
 		rv.prxProto = "socks5"
-		targetURL, err := url.Parse(rv.targetAddr)
-		if err != nil {
-			log.Fatal("Can't parse Target URL:" + rv.targetAddr)
-			panic(err)
+	}
+	for _, t := range rv.targets {
+		if _, err := url.Parse(t.URL); err != nil {
+			log.Fatal("Can't parse Target URL:" + t.URL)
 		}
-		rv.targetURL = targetURL
+	}
+	// SSRF audit report is per proxy, the destinations are its columns
+	if len(rv.targets) > 1 && rv.groupBy == "" && rv.ssrfAudit == nil {
+		rv.groupBy = "target"
 	}
 	if rv.countryMmdbPath == "" {
 		countryMmdbPathEnv := os.Getenv("PROXYCHICK_MMDB_COUNTRY")
@@ -115,6 +383,30 @@ func NewCmdCfg() CmdCfg {
 			log.Fatal("Failed to open GeoLite2-Country.mmdb - ", err)
 		}
 	}
+	if rv.asnMmdbPath == "" {
+		asnMmdbPathEnv := os.Getenv("PROXYCHICK_MMDB_ASN")
+		if asnMmdbPathEnv != "" {
+			rv.asnMmdbPath = asnMmdbPathEnv
+		}
+	}
+	if rv.asnMmdbPath != "" {
+		_, err := geoip2.Open(rv.asnMmdbPath)
+		if err != nil {
+			log.Fatal("Failed to open GeoLite2-ASN.mmdb - ", err)
+		}
+	}
+	if !slices.Contains(client.ProxyModes, rv.proxyMode) {
+		log.Fatal("Unsupported proxyMode:" + rv.proxyMode)
+	}
+	if rv.groupBy != "" && !slices.Contains(stat.GroupByDimensions, rv.groupBy) {
+		log.Fatal("Unsupported groupBy dimension:" + rv.groupBy)
+	}
+	if (rv.groupBy == "country" && rv.countryMmdbPath == "") || (rv.groupBy == "asn" && rv.asnMmdbPath == "") {
+		log.Fatal("groupBy " + rv.groupBy + " requires the corresponding mmdb file")
+	}
+	if rv.groupLayout != "tables" && rv.groupLayout != "pivot" {
+		log.Fatal("Unsupported groupLayout:" + rv.groupLayout)
+	}
 	return rv
 }
 
@@ -191,15 +483,128 @@ func main() {
 	var pStringsFormated []*url.URL
 	statOutputs := []io.Writer{os.Stdout}
 	cmdCfg := NewCmdCfg()
+	if cmdCfg.judgeAddr != "" || cmdCfg.judgeEchoAddr != "" || cmdCfg.judgeEchoPorts != nil || cmdCfg.judgeCanaryAddr != "" || cmdCfg.judgeUDPEchoAddr != "" {
+		judgeErr := make(chan error)
+		if cmdCfg.judgeAddr != "" {
+			go func() { judgeErr <- judge.ListenAndServe(cmdCfg.judgeAddr) }()
+		}
+		if cmdCfg.judgeEchoAddr != "" {
+			go func() { judgeErr <- judge.ListenAndServeEcho(cmdCfg.judgeEchoAddr) }()
+		}
+		if cmdCfg.judgeUDPEchoAddr != "" {
+			go func() { judgeErr <- judge.ListenAndServeUDPEcho(cmdCfg.judgeUDPEchoAddr) }()
+		}
+		if cmdCfg.judgeCanaryAddr != "" {
+			go func() { judgeErr <- judge.ListenAndServeCanary(cmdCfg.judgeCanaryAddr) }()
+		}
+		echoHost, _, _ := net.SplitHostPort(cmdCfg.judgeEchoAddr)
+		for _, port := range cmdCfg.judgeEchoPorts {
+			addr := net.JoinHostPort(echoHost, strconv.Itoa(port))
+			go func() { judgeErr <- judge.ListenAndServeEcho(addr) }()
+		}
+		log.Fatal(<-judgeErr)
+	}
 	pStringsRaw = GetProxyStrings(cmdCfg.inPath)
 	resultsCh := make(chan client.Result, len(pStringsRaw))
 	jobCfg := job.PListEvanJobCfg{
-		cmdCfg.maxConcurrency,
-		*cmdCfg.targetURL,
-		cmdCfg.timeOut,
-		cmdCfg.transport,
-		debug,
+		MaxConcurrency: cmdCfg.maxConcurrency,
+		TimeOut:        cmdCfg.timeOut,
+		Transport:      cmdCfg.transport,
+		Debug:          debug,
+		MaxBytes:       cmdCfg.maxBytes,
+		Tunnel:         cmdCfg.tunnel,
+		PortAudit:      cmdCfg.portAudit,
+		SSRFAudit:      cmdCfg.ssrfAudit,
+		UDPStream:      cmdCfg.udpStream,
+		UDPProbe:       cmdCfg.udpProbe,
+		UDPMTU:         cmdCfg.udpMTU,
+		Retry:          cmdCfg.retry,
+		RPS:            cmdCfg.rps,
 	}
+	if cmdCfg.transport == "tcp" {
+		proxyTLS, err := cmdCfg.proxyTLS.NewTLSConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		jobCfg.ProxyTLS = proxyTLS
+		if cmdCfg.tunnel != nil {
+			cmdCfg.tunnel.ProxyTLS = proxyTLS
+		}
+		if cmdCfg.portAudit != nil {
+			cmdCfg.portAudit.ProxyTLS = proxyTLS
+		}
+		if cmdCfg.ssrfAudit != nil {
+			cmdCfg.ssrfAudit.ProxyTLS = proxyTLS
+		}
+		if cmdCfg.authCheck {
+			jobCfg.AuthCheck = &client.AuthCheckOpts{ProxyTLS: proxyTLS, ProxyMode: cmdCfg.proxyMode}
+		}
+		if jobCfg.TCPOpts, err = client.NewTCPTestOpts(cmdCfg.tcpProbe, proxyTLS); err != nil {
+			log.Fatal(err)
+		}
+		targetTLS, err := cmdCfg.targetTLS.NewTLSConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		jobCfg.HTTPOpts = &client.HTTPTestOpts{ProxyTLS: proxyTLS, TargetTLS: targetTLS, ProxyMode: cmdCfg.proxyMode, Request: &cmdCfg.request, Timeouts: &cmdCfg.httpTimeouts}
+		if cmdCfg.detectBlocks || cmdCfg.blockRulesPath != "" {
+			jobCfg.HTTPOpts.BlockRules = client.DefaultBlockRules()
+			if cmdCfg.blockRulesPath != "" {
+				customRules, err := client.LoadBlockRules(cmdCfg.blockRulesPath)
+				if err != nil {
+					log.Fatal(err)
+				}
+				jobCfg.HTTPOpts.BlockRules = customRules.Append(jobCfg.HTTPOpts.BlockRules)
+			}
+		}
+		jobCfg.HTTPOpts.Bandwidth = cmdCfg.bandwidth
+		if cmdCfg.keepAlive > 1 {
+			jobCfg.HTTPOpts.KeepAlive = &client.KeepAliveCfg{Requests: cmdCfg.keepAlive}
+		}
+		if cmdCfg.redirects.MaxHops > 0 {
+			jobCfg.HTTPOpts.Redirects = &cmdCfg.redirects
+		}
+		if !cmdCfg.validation.IsEmpty() {
+			if jobCfg.HTTPOpts.Validator, err = client.NewValidator(cmdCfg.validation); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	for _, targetCfg := range cmdCfg.targets {
+		targetURL, _ := url.Parse(targetCfg.URL)
+		target := job.Target{URL: *targetURL}
+		if jobCfg.HTTPOpts != nil && (targetCfg.Request != nil || targetCfg.Validation != nil) {
+			targetOpts := *jobCfg.HTTPOpts
+			if targetCfg.Request != nil {
+				request := cmdCfg.request.Merge(*targetCfg.Request)
+				if err := request.Load(); err != nil {
+					log.Fatal(err)
+				}
+				targetOpts.Request = &request
+			}
+			if targetCfg.Validation != nil {
+				validation := cmdCfg.validation.Merge(*targetCfg.Validation)
+				targetOpts.Validator = nil
+				if !validation.IsEmpty() {
+					validator, err := client.NewValidator(validation)
+					if err != nil {
+						log.Fatal(err)
+					}
+					targetOpts.Validator = validator
+				}
+			}
+			target.HTTPOpts = &targetOpts
+		}
+		if jobCfg.TCPOpts != nil && targetCfg.TCP != nil {
+			tcpOpts, err := client.NewTCPTestOpts(cmdCfg.tcpProbe.Merge(*targetCfg.TCP), jobCfg.TCPOpts.ProxyTLS)
+			if err != nil {
+				log.Fatal(err)
+			}
+			target.TCPOpts = tcpOpts
+		}
+		jobCfg.Targets = append(jobCfg.Targets, target)
+	}
+	jobCfg.TargetURL = jobCfg.Targets[0].URL
 	for _, PrxStrRaw := range pStringsRaw {
 		prxURL, err := job.AdaptRawProxyStr(PrxStrRaw, cmdCfg.prxProto)
 		if err != nil {
@@ -216,34 +621,71 @@ func main() {
 		pStringsFormated = tmpStringsFormated
 	}
 	JobStarted := time.Now()
-	go job.EvaluateProxyList(pStringsFormated, &jobCfg, resultsCh)
+	jobErr := make(chan error, 1)
+	go func() { jobErr <- job.EvaluateProxyList(pStringsFormated, &jobCfg, resultsCh) }()
+	tasksCnt := jobCfg.TasksCnt(len(pStringsFormated))
 	if cmdCfg.isPorgresBarEnabled {
-		bar = progressbar.Default(int64(len(pStringsFormated)))
+		bar = progressbar.Default(int64(tasksCnt))
 	}
-	for i := 0; i < len(pStringsFormated); i++ {
-		res := <-resultsCh
+	for res := range resultsCh {
 		results = append(results, &res)
+		jobMetrics.Traffic = jobMetrics.Traffic.Add(res.Traffic)
 		if cmdCfg.isPorgresBarEnabled {
 			bar.Add(1)
 		}
 	}
 	jobMetrics.Duration = time.Since(JobStarted)
+	jobMetrics.Cost = float64(jobMetrics.Traffic.Total()) / (1 << 30) * cmdCfg.pricePerGB
+	if cmdCfg.rps != nil {
+		jobMetrics.TargetRPS = cmdCfg.rps.Schedule.Rate()
+		jobMetrics.AchievedRPS = cmdCfg.rps.Schedule.AchievedRate(results)
+	}
+	if err := <-jobErr; cmdCfg.maxBytes > 0 && errors.Is(err, job.MaxBytesExceededError) {
+		log.Printf("Traffic budget(maxBytes) exceeded, %d of %d tests were done", len(results), tasksCnt)
+	}
 	outTxt, _ := formatResulst(results, "csv")
 	retFinalText(cmdCfg.outPath, outTxt)
 	if cmdCfg.isStatsEnables {
-		_ = stat.ProcTestResults(results, statOutputs, cmdCfg.transport, &jobMetrics)
-
+		var countryDB, asnDB *geoip2.Reader
 		if cmdCfg.countryMmdbPath != "" {
-			db, err := geoip2.Open(cmdCfg.countryMmdbPath)
-			defer db.Close()
-			if err == nil {
-				_ = stat.ProcIPTestResults(results, statOutputs, *db)
+			if db, err := geoip2.Open(cmdCfg.countryMmdbPath); err == nil {
+				defer db.Close()
+				countryDB = db
+			}
+		}
+		if cmdCfg.asnMmdbPath != "" {
+			if db, err := geoip2.Open(cmdCfg.asnMmdbPath); err == nil {
+				defer db.Close()
+				asnDB = db
+			}
+		}
+		_ = stat.ProcTestResults(results, statOutputs, cmdCfg.transport, &jobMetrics)
 
+		if countryDB != nil {
+			_ = stat.ProcIPTestResults(results, statOutputs, *countryDB)
+		}
+		if cmdCfg.groupBy != "" {
+			keyFn, err := stat.NewGroupKeyFunc(cmdCfg.groupBy, countryDB, asnDB)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if cmdCfg.groupLayout == "pivot" {
+				_ = stat.ProcPivotTestResults(results, statOutputs, cmdCfg.groupBy, keyFn)
+			} else {
+				_ = stat.ProcGroupedTestResults(results, statOutputs, cmdCfg.transport, cmdCfg.groupBy, keyFn)
 			}
 		}
 	}
 	for _, o := range statOutputs {
 	    o.Write([]byte(fmt.Sprintf("Duration:%s\n", jobMetrics.Duration.String())))
+	    o.Write([]byte(fmt.Sprintf("Traffic:%s (sent %s, received %s)", utils.FormatSize(jobMetrics.Traffic.Total()), utils.FormatSize(jobMetrics.Traffic.Sent), utils.FormatSize(jobMetrics.Traffic.Received))))
+	    if cmdCfg.pricePerGB > 0 {
+	        o.Write([]byte(fmt.Sprintf(" Estimated cost:%.4f", jobMetrics.Cost)))
+	    }
+	    o.Write([]byte("\n"))
+	    if jobMetrics.TargetRPS > 0 {
+	        o.Write([]byte(fmt.Sprintf("Request rate:target %.1f rps, achieved %.1f rps\n", jobMetrics.TargetRPS, jobMetrics.AchievedRPS)))
+	    }
 	    o.Write([]byte(fmt.Sprintf("Unique Exit Nodes IPs:%d", jobMetrics.UniqueExitNodesIPCnt)))
 	    o.Write([]byte(fmt.Sprintf(" (%.0f%% of Rquests and ", 100.00*float64(jobMetrics.UniqueExitNodesIPCnt)/float64(jobMetrics.ReqsCnt))))
 	    o.Write([]byte(fmt.Sprintf("%.0f%% of Responces)", 100.00*float64(jobMetrics.UniqueExitNodesIPCnt)/float64(jobMetrics.RespCnt))))
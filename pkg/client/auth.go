@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Outcome of the auth probe when the proxy let it through anyway.
+const AuthOpen = "open"
+
+// Settings of the auth enforcement check.
+type AuthCheckOpts struct {
+	ProxyTLS  *tls.Config // proxy leg of TLSCfg
+	ProxyMode string      // one of ProxyModes the HTTP test uses, forward one is probed with absolute-URI request
+}
+
+type AuthStats struct {
+	NoCreds    string `csv:"noCreds" json:"noCreds"`       // outcome of the probe without credentials: open, proxy status code, SOCKS reply or error
+	WrongCreds string `csv:"wrongCreds" json:"wrongCreds"` // same for the probe with the wrong password(wrong user ID for SOCKS4)
+	Open       bool   `csv:"open" json:"open"`             // any of the probes got through
+}
+
+// Proxy status code or SOCKS reply tells how the proxy rejected the probe, the error is reported when there is neither.
+func authProbeOutcome(probeRes *Result, err error) string {
+	switch {
+	case err == nil:
+		return AuthOpen
+	case probeRes.ProxyStatusCode != 0:
+		return strconv.Itoa(probeRes.ProxyStatusCode)
+	case probeRes.ProxySOCKSReply != "":
+		return probeRes.ProxySOCKSReply
+	}
+	return err.Error()
+}
+
+// Forward request is rejected with 407 in place of the target reply, any other reply means the proxy let it through.
+func forwardAuthProbeOutcome(probeRes *Result, err error) string {
+	switch {
+	case probeRes.TargetStatusCode == http.StatusProxyAuthRequired:
+		return strconv.Itoa(probeRes.TargetStatusCode)
+	case err == nil:
+		return AuthOpen
+	}
+	return err.Error()
+}
+
+// Reaches the target through the proxy without credentials and with the wrong ones, both have to be rejected.
+// Proxy is probed the way the test reaches the target: tunnel(CONNECT or SOCKS) or absolute-URI request for the forward mode.
+// Only proxies with credentials are probed, empty stats are returned for the others.
+func CheckAuth(proxyURL *url.URL, targetURL *url.URL, timeOut time.Duration, opts *AuthCheckOpts) (AuthStats, Traffic) {
+	rv := AuthStats{}
+	traffic := &trafficCounter{}
+	if proxyURL.User == nil {
+		return rv, traffic.traffic()
+	}
+	forward := (targetURL.Scheme == "http" || targetURL.Scheme == "https") &&
+		resolveProxyMode(opts.ProxyMode, proxyURL, targetURL) == ProxyModeForward
+	var forwardTraffic Traffic
+	probe := func(user *url.Userinfo) string {
+		probeURL := *proxyURL
+		probeURL.User = user
+		if forward {
+			probeRes, err := TestHTTP(targetURL, &probeURL, timeOut, false, &HTTPTestOpts{ProxyTLS: opts.ProxyTLS, ProxyMode: ProxyModeForward})
+			forwardTraffic = forwardTraffic.Add(probeRes.Traffic)
+			return forwardAuthProbeOutcome(probeRes, err)
+		}
+		probeRes := &Result{}
+		ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+		defer cancel()
+		conn, err := dialTunnel(ctx, &probeURL, targetHostPort(targetURL), opts.ProxyTLS, traffic, probeRes)
+		if err == nil {
+			conn.Close()
+		}
+		return authProbeOutcome(probeRes, err)
+	}
+	rv.NoCreds = probe(nil)
+	wrongCreds := url.UserPassword(proxyURL.User.Username(), "proxychick-wrong-password")
+	if proxyURL.Scheme == "socks4" || proxyURL.Scheme == "socks4a" {
+		// SOCKS4 has no password, the user ID alone is checked
+		wrongCreds = url.User("proxychick-wrong-user")
+	}
+	rv.WrongCreds = probe(wrongCreds)
+	rv.Open = rv.NoCreds == AuthOpen || rv.WrongCreds == AuthOpen
+	return rv, traffic.traffic().Add(forwardTraffic)
+}
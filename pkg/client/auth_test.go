@@ -0,0 +1,37 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCheckAuthForwardOnlyProxy(t *testing.T) {
+	proxyURL := newForwardProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if user, pass, ok := parseProxyAuth(r); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	proxyURL.User = url.UserPassword("user", "pass")
+	targetURL, _ := url.Parse("http://auth.test/")
+	stats, traffic := CheckAuth(proxyURL, targetURL, time.Second, &AuthCheckOpts{ProxyMode: ProxyModeAuto})
+	if stats.NoCreds != "407" || stats.WrongCreds != "407" || stats.Open {
+		t.Errorf("CheckAuth() = %+v, want both probes rejected with 407", stats)
+	}
+	if traffic.Total() == 0 {
+		t.Error("CheckAuth() traffic of the forward probes is not counted")
+	}
+}
+
+// Credentials of the Proxy-Authorization header, the same way net/http parses Authorization.
+func parseProxyAuth(r *http.Request) (user, pass string, ok bool) {
+	req := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+	return req.BasicAuth()
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"io"
+	"time"
+)
+
+// Peak throughput is the best rate over windows of this length.
+const throughputWindow = 250 * time.Millisecond
+
+// Head of the downloaded reply kept for validation, block rules and exit IP, the rest is discarded.
+const bandwidthBodyHead = 16 << 10
+
+// Bandwidth mode of the HTTP checker: the whole target reply is downloaded and measured.
+type BandwidthCfg struct {
+	Upload int64 // bytes of payload sent as the request body, 0 disables upload
+}
+
+// Transfer volume and rates of the bandwidth mode, rates are in KB/s(1024 bytes) like the sizes of utils.ParseSize.
+type Throughput struct {
+	BytesDown int64 `csv:"bytesDown" json:"bytesDown"`
+	BytesUp   int64 `csv:"bytesUp" json:"bytesUp"`
+	DownAvg   int   `csv:"downAvg" json:"downAvg"`
+	DownPeak  int   `csv:"downPeak" json:"downPeak"`
+	UpAvg     int   `csv:"upAvg" json:"upAvg"`
+	UpPeak    int   `csv:"upPeak" json:"upPeak"`
+}
+
+// Counts bytes passed through Read and tracks average and peak rates, the clock starts with the first Read.
+type throughputMeter struct {
+	r             io.Reader
+	started       time.Time
+	finished      time.Time
+	windowStarted time.Time
+	n             int64
+	windowN       int64
+	peak          float64 // bytes per second
+}
+
+func newThroughputMeter(r io.Reader) *throughputMeter {
+	return &throughputMeter{r: r}
+}
+
+func (m *throughputMeter) Read(p []byte) (int, error) {
+	if m.started.IsZero() {
+		m.started = time.Now()
+		m.windowStarted = m.started
+	}
+	n, err := m.r.Read(p)
+	now := time.Now()
+	m.n += int64(n)
+	m.windowN += int64(n)
+	if elapsed := now.Sub(m.windowStarted); elapsed >= throughputWindow {
+		m.peak = max(m.peak, float64(m.windowN)/elapsed.Seconds())
+		m.windowStarted, m.windowN = now, 0
+	}
+	m.finished = now
+	return n, err
+}
+
+// Average and peak rates in KB/s, peak is the average for transfers shorter than throughputWindow.
+func (m *throughputMeter) rates() (int, int) {
+	elapsed := m.finished.Sub(m.started).Seconds()
+	if m.n == 0 || elapsed <= 0 {
+		return 0, 0
+	}
+	avg := float64(m.n) / elapsed
+	return int(avg / 1024), int(max(m.peak, avg) / 1024)
+}
+
+// Endless payload reader for uploads.
+type payloadReader struct{}
+
+func (payloadReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i)
+	}
+	return len(p), nil
+}
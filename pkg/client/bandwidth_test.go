@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Plain HTTP server answering absolute-URI requests itself, like the forward proxy does.
+func newForwardProxy(t *testing.T, handler http.HandlerFunc) *url.URL {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	proxyURL, _ := url.Parse(srv.URL)
+	return proxyURL
+}
+
+func TestBandwidthBodyNotKept(t *testing.T) {
+	const size = 5 << 20
+	proxyURL := newForwardProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(make([]byte, size))
+	})
+	validator, err := NewValidator(ValidationCfg{MaxBodySize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, _ := url.Parse("http://bandwidth.test/bytes")
+	res, err := TestHTTP(targetURL, proxyURL, 5*time.Second, true, &HTTPTestOpts{Bandwidth: &BandwidthCfg{}, Validator: validator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Throughput.BytesDown != size {
+		t.Errorf("BytesDown = %d, want %d", res.Throughput.BytesDown, size)
+	}
+	if res.RespPayload != "" {
+		t.Errorf("RespPayload keeps %d bytes, want none", len(res.RespPayload))
+	}
+	// body size is checked against the whole download, not the head kept for the checks
+	if len(res.ValidationErrors) != 1 || res.ValidationErrors[0] != ValidationBodySize {
+		t.Errorf("ValidationErrors = %v, want [%s]", res.ValidationErrors, ValidationBodySize)
+	}
+}
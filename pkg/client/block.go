@@ -0,0 +1,137 @@
+package client
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+)
+
+// Labels of the target response.
+const (
+	BlockOK      = "ok"
+	BlockBlocked = "blocked"
+	BlockCaptcha = "captcha"
+)
+
+//go:embed blockrules.yaml
+var defaultBlockRules []byte
+
+// Signature of the block or captcha page, all set conditions have to match.
+type BlockRuleCfg struct {
+	Name    string            `yaml:"name"`
+	Label   string            `yaml:"label"` // blocked or captcha
+	Hosts   string            `yaml:"hosts"` // target host regex, empty matches any target
+	Status  []int             `yaml:"status"`
+	Headers map[string]string `yaml:"headers"` // header name to value regex
+	Body    string            `yaml:"body"`    // body regex
+}
+
+type BlockRulesCfg struct {
+	Rules []BlockRuleCfg `yaml:"rules"`
+}
+
+type blockRule struct {
+	cfg     BlockRuleCfg
+	hosts   *regexp.Regexp
+	headers map[string]*regexp.Regexp
+	body    *regexp.Regexp
+}
+
+// Compiled rule pack, rules are checked in order.
+type BlockRules struct {
+	rules []*blockRule
+}
+
+func ParseBlockRules(content []byte) (*BlockRules, error) {
+	cfg := BlockRulesCfg{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, errors.New("block rules: Can't parse: " + err.Error())
+	}
+	rv := &BlockRules{}
+	for _, ruleCfg := range cfg.Rules {
+		rule, err := compileBlockRule(ruleCfg)
+		if err != nil {
+			return nil, err
+		}
+		rv.rules = append(rv.rules, rule)
+	}
+	return rv, nil
+}
+
+func compileBlockRule(cfg BlockRuleCfg) (*blockRule, error) {
+	var err error
+	if cfg.Label != BlockBlocked && cfg.Label != BlockCaptcha {
+		return nil, errors.New("block rules: " + cfg.Name + ": label has to be blocked or captcha")
+	}
+	rule := &blockRule{cfg: cfg, headers: make(map[string]*regexp.Regexp)}
+	if cfg.Hosts != "" {
+		if rule.hosts, err = regexp.Compile(cfg.Hosts); err != nil {
+			return nil, errors.New("block rules: " + cfg.Name + ": " + err.Error())
+		}
+	}
+	if cfg.Body != "" {
+		if rule.body, err = regexp.Compile(cfg.Body); err != nil {
+			return nil, errors.New("block rules: " + cfg.Name + ": " + err.Error())
+		}
+	}
+	for name, expr := range cfg.Headers {
+		if rule.headers[name], err = regexp.Compile(expr); err != nil {
+			return nil, errors.New("block rules: " + cfg.Name + ": " + err.Error())
+		}
+	}
+	return rule, nil
+}
+
+// Built-in rule pack.
+func DefaultBlockRules() *BlockRules {
+	rv, err := ParseBlockRules(defaultBlockRules)
+	if err != nil {
+		panic(err)
+	}
+	return rv
+}
+
+func LoadBlockRules(path string) (*BlockRules, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("block rules: Can't read " + path + ": " + err.Error())
+	}
+	return ParseBlockRules(content)
+}
+
+// Rules of other are appended after the ones of r.
+func (r *BlockRules) Append(other *BlockRules) *BlockRules {
+	return &BlockRules{rules: append(slices.Clone(r.rules), other.rules...)}
+}
+
+func (rule *blockRule) match(host string, resp *http.Response, body []byte) bool {
+	if rule.hosts != nil && !rule.hosts.MatchString(host) {
+		return false
+	}
+	if len(rule.cfg.Status) > 0 && !slices.Contains(rule.cfg.Status, resp.StatusCode) {
+		return false
+	}
+	for name, expr := range rule.headers {
+		if !slices.ContainsFunc(resp.Header.Values(name), expr.MatchString) {
+			return false
+		}
+	}
+	return rule.body == nil || rule.body.Match(body)
+}
+
+// Returns the label and the name of the first matching rule, ok label and empty name if nothing matched.
+func (r *BlockRules) Classify(host string, resp *http.Response, body []byte) (string, string) {
+	for _, rule := range r.rules {
+		if rule.match(host, resp, body) {
+			return rule.cfg.Label, rule.cfg.Name
+		}
+	}
+	return BlockOK, ""
+}
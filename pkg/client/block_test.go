@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Reads the recorded raw HTTP response from testdata/block.
+func readBlockFixture(t *testing.T, name string) (*http.Response, []byte) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "block", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	resp, err := http.ReadResponse(bufio.NewReader(f), nil)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return resp, body
+}
+
+func TestClassifyRecordedPages(t *testing.T) {
+	rules := DefaultBlockRules()
+	cases := []struct {
+		fixture string
+		host    string
+		label   string
+		rule    string
+	}{
+		{"cloudflare_challenge.http", "www.example.com", BlockCaptcha, "cloudflare-challenge-page"},
+		{"google_unusual_traffic.http", "www.google.com", BlockCaptcha, "google-unusual-traffic"},
+		{"akamai_denied.http", "www.example.com", BlockBlocked, "akamai-access-denied"},
+		{"plain_ok.http", "www.example.com", BlockOK, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			resp, body := readBlockFixture(t, c.fixture)
+			label, rule := rules.Classify(c.host, resp, body)
+			if label != c.label || rule != c.rule {
+				t.Errorf("Classify() = %q, %q, want %q, %q", label, rule, c.label, c.rule)
+			}
+		})
+	}
+}
+
+func TestClassifyHostsLimitsRule(t *testing.T) {
+	// Google captcha body served by another host isn't the Google rule, but the generic reCAPTCHA one still matches
+	resp, body := readBlockFixture(t, "google_unusual_traffic.http")
+	label, rule := DefaultBlockRules().Classify("www.example.com", resp, body)
+	if label != BlockCaptcha || rule != "recaptcha-hcaptcha" {
+		t.Errorf("Classify() = %q, %q, want %q, %q", label, rule, BlockCaptcha, "recaptcha-hcaptcha")
+	}
+}
+
+func TestClassifyOwnRulesFirst(t *testing.T) {
+	own, err := ParseBlockRules([]byte("rules:\n  - name: own\n    label: blocked\n    body: 'Example Domain'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body := readBlockFixture(t, "plain_ok.http")
+	label, rule := own.Append(DefaultBlockRules()).Classify("www.example.com", resp, body)
+	if label != BlockBlocked || rule != "own" {
+		t.Errorf("Classify() = %q, %q, want %q, %q", label, rule, BlockBlocked, "own")
+	}
+}
+
+func TestParseBlockRulesMalformed(t *testing.T) {
+	cases := map[string]struct {
+		rules  string
+		errMsg string
+	}{
+		"bad yaml":       {"rules: [", "Can't parse"},
+		"unknown field":  {"rules:\n  - name: x\n    label: blocked\n    bodyy: 'a'\n", "Can't parse"},
+		"bad label":      {"rules:\n  - name: x\n    label: denied\n", "x: label has to be blocked or captcha"},
+		"no label":       {"rules:\n  - name: x\n    body: 'a'\n", "x: label has to be blocked or captcha"},
+		"bad body regex": {"rules:\n  - name: x\n    label: blocked\n    body: '(a'\n", "x: error parsing regexp"},
+		"bad host regex": {"rules:\n  - name: x\n    label: captcha\n    hosts: '[a'\n", "x: error parsing regexp"},
+		"bad header":     {"rules:\n  - name: x\n    label: captcha\n    headers:\n      Server: '*a'\n", "x: error parsing regexp"},
+		"status string":  {"rules:\n  - name: x\n    label: blocked\n    status: forbidden\n", "Can't parse"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			rules, err := ParseBlockRules([]byte(c.rules))
+			if err == nil {
+				t.Fatalf("ParseBlockRules() = %v, want error", rules)
+			}
+			if !strings.HasPrefix(err.Error(), "block rules: ") || !strings.Contains(err.Error(), c.errMsg) {
+				t.Errorf("ParseBlockRules() error = %q, want it to contain %q", err, c.errMsg)
+			}
+		})
+	}
+}
+
+func TestDefaultBlockRulesParse(t *testing.T) {
+	if rules := DefaultBlockRules(); len(rules.rules) == 0 {
+		t.Error("built-in rule pack is empty")
+	}
+}
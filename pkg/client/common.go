@@ -3,19 +3,34 @@ package client
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Latency struct {
-	TTFB         int `csv:"ttfb",json:"ttfb""`
-	DNSresolve   int `csv:"dnsResolve",json:"dnsResolve"`
-	Connect      int `csv:"conn",json:"conn"`
-	TLSHandshake int `csv:"tlsHandShake",json:"tlsHandShake"`
-	ProxyResp    int `csv:"proxyResp",json:"proxyResp"`
+	TTFB         int `csv:"ttfb" json:"ttfb"`
+	DNSresolve   int `csv:"dnsResolve" json:"dnsResolve"`
+	Connect      int `csv:"conn" json:"conn"`
+	TLSHandshake int `csv:"tlsHandShake" json:"tlsHandShake"`
+	ProxyResp    int `csv:"proxyResp" json:"proxyResp"`
+	// TLS handshake btw client and https:// proxy, TLSHandshake above is the one with the target
+	ProxyTLSHandshake int `csv:"proxyTlsHandShake" json:"proxyTlsHandShake"`
+	SOCKSGreeting     int `csv:"socksGreeting" json:"socksGreeting"` // SOCKS5 auth method selection round trip
+	SOCKSAuth         int `csv:"socksAuth" json:"socksAuth"`         // SOCKS5 username/password round trip
+	TTLB              int `csv:"ttlb" json:"ttlb"`                   // time to the last byte of the reply, bandwidth mode only
+}
+
+// Timing of the test started by the open model(rps) schedule.
+// Latency since the scheduled start includes the lag, so it's corrected for coordinated omission.
+type LoadStats struct {
+	Scheduled int `csv:"scheduled" json:"scheduled"` // ms since the load start the test was due
+	Lag       int `csv:"lag" json:"lag"`             // ms the test started behind the schedule, e.g. while maxInFlight tests were running
+	TTFB      int `csv:"ttfb" json:"ttfb"`           // TTFB plus lag, 0 for the failed tests
 }
 
 type PChickError struct {
@@ -40,45 +55,104 @@ type URL struct {
 func (u URL) MarshalCSV() (string, error) {
 	return u.String(), nil
 }
-func (u URL) MarshalJSON() (string, error) {
-	return u.String(), nil
+func (u URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.String())
+}
+
+// List of strings, kept in a single CSV cell.
+type StrList []string
+
+func (l StrList) MarshalCSV() (string, error) {
+	return strings.Join(l, " "), nil
+}
+
+// List of integers, kept in a single CSV cell.
+type IntList []int
+
+func (l IntList) MarshalCSV() (string, error) {
+	items := make([]string, len(l))
+	for i, v := range l {
+		items[i] = strconv.Itoa(v)
+	}
+	return StrList(items).MarshalCSV()
+}
+
+// Single try of the test, filled only when retries are on.
+type Attempt struct {
+	N        int    `json:"n"`
+	Category string `json:"category"` // category of the error, empty for the successful attempt
+	Error    string `json:"error"`
+	Latency  int    `json:"latency"` // ms the attempt took
+}
+
+// Attempts made to test the proxy, the last one is the reported result.
+type AttemptList []Attempt
+
+func (l AttemptList) MarshalCSV() (string, error) {
+	items := make([]string, len(l))
+	for i, a := range l {
+		outcome := a.Category
+		if outcome == "" {
+			outcome = "ok"
+		}
+		items[i] = fmt.Sprintf("%d %s %dms", a.N, outcome, a.Latency)
+	}
+	return strings.Join(items, " > "), nil
 }
 
 type Result struct {
-	ProxyURL         URL         `csv:"proxy",json:"proxy,string"`
-	Status           bool        `csv:"result",json:"result"`
-	TargetURL        url.URL     `csv:"-",json:"-"`
-	TargetStatusCode int         `csv:"targetStatusCode",json:"targetStatusCode"`
-	ProxyStatusCode  int         `csv:"proxyStatusCode",json:"proxyStatusCode"`
-	RespPayload      string      `csv:"-",json:"-"`
-	ProxyRespHeader  http.Header `csv:"-",json:"-"`
-	Latency          Latency     `csv:"latency",json:"latency"`
-	ProxyServIPAddr  net.IP      `csv:"ProxyServIPAddr",json:"ProxyServIPAddr"`
-	ProxyNodeIPAddr  net.IP      `csv:"ProxyNodeIPAddr",json:"ProxyNodeIPAddr"`
-	Error            PChickError `csv:"error",json:"error"`
-	Ts               time.Time   `csv:"-",json:"ts"`
+	ProxyURL         URL     `csv:"proxy" json:"proxy"`
+	Label            string  `csv:"label" json:"label"`
+	TargetURL        URL     `csv:"target" json:"target"`
+	Status           bool    `csv:"result" json:"result"`                     // target replied on time with any status code
+	Valid            bool    `csv:"valid" json:"valid"`                       // target reply passed validation rules
+	ValidationErrors StrList `csv:"validationErrors" json:"validationErrors"` // categories of failed validation rules
+	BlockStatus      string  `csv:"blockStatus" json:"blockStatus"`           // ok, blocked or captcha, empty if block detection is off
+	BlockRule        string  `csv:"blockRule" json:"blockRule"`               // name of the matched block rule
+	TargetStatusCode int     `csv:"targetStatusCode" json:"targetStatusCode"` // status of the last reply when redirects are followed
+	RedirectCnt      int     `csv:"redirects" json:"redirects"`               // number of followed redirects
+	Banner           string  `csv:"banner" json:"banner"`                     // first line of the raw TCP target reply
+	// requests made to reach the target, filled only when redirects following is on
+	RedirectChain   RedirectChain `csv:"redirectChain" json:"redirectChain"`
+	ProxyStatusCode int           `csv:"proxyStatusCode" json:"proxyStatusCode"`
+	ProxySOCKSReply string        `csv:"proxySocksReply" json:"proxySocksReply"`
+	ProxyMode       string        `csv:"proxyMode" json:"proxyMode"` // forward or connect, empty for SOCKS
+	// protocols proxy endpoint speaks, filled only for proxies with auto detected scheme
+	DetectedProtocols StrList        `csv:"detectedProtocols" json:"detectedProtocols"`
+	RespPayload       string         `csv:"-" json:"-"`
+	ProxyRespHeader   http.Header    `csv:"-" json:"-"`
+	Latency           Latency        `csv:"latency" json:"latency"`
+	Timeout           string         `csv:"timeout" json:"timeout"`       // budget the HTTP checker exceeded, one of Timeout*
+	Attempts          AttemptList    `csv:"attempts" json:"attempts"`     // filled only when retries are on
+	Load              LoadStats      `csv:"load" json:"load"`             // filled only in the open model(rps)
+	Throughput        Throughput     `csv:"throughput" json:"throughput"` // filled only in bandwidth mode
+	Traffic           Traffic        `csv:"traffic" json:"traffic"`
+	Tunnel            TunnelStats    `csv:"tunnel" json:"tunnel"`       // filled only by the tunnel stability checker
+	KeepAlive         KeepAliveStats `csv:"keepAlive" json:"keepAlive"` // keep-alive mode only, Latency is the one of the first request
+	Ports             PortAuditStats `csv:"ports" json:"ports"`         // filled only by the port policy audit
+	SSRF              SSRFStats      `csv:"ssrf" json:"ssrf"`           // filled only by the internal network reachability audit
+	Auth              AuthStats      `csv:"auth" json:"auth"`           // filled only by the auth enforcement check
+	UDP               UDPStreamStats `csv:"udp" json:"udp"`             // filled only in UDP quality mode
+	UDPProbe          UDPProbeStats  `csv:"udpProbe" json:"udpProbe"`   // filled only by the DNS, STUN and NTP probes
+	UDPMTU            UDPMTUStats    `csv:"udpMtu" json:"udpMtu"`       // filled only by the datagram size probe
+	ProxyServIPAddr   net.IP         `csv:"ProxyServIPAddr" json:"ProxyServIPAddr"`
+	ProxyNodeIPAddr   net.IP         `csv:"ProxyNodeIPAddr" json:"ProxyNodeIPAddr"`
+	Error             PChickError    `csv:"error" json:"error"`
+	Ts                time.Time      `csv:"-" json:"ts"`
 }
 
 func (res *Result) MarshalJSON() ([]byte, error) {
+	// alias has no MarshalJSON, so all tagged fields are serialised as is, except the overridden below
+	type resultAlias Result
 	errStr, _ := res.Error.MarshalCSV()
 	return json.Marshal(struct {
-		ProxyURL         string  `json:"proxy"`
-		Status           bool    `json:"result"`
-		TargetStatusCode int     `json:"targetStatusCode"`
-		ProxyStatusCode  int     `json:"proxyStatusCode"`
-		Latency          Latency `json:"latency"`
-		ProxyServIPAddr  net.IP  `json:"ProxyServIPAddr"`
-		ProxyNodeIPAddr  net.IP  `json:"ProxyNodeIPAddr"`
-		Error            string  `json:"error"`
-		Ts               int64   `json:"ts"`
+		*resultAlias
+		ProxyURL string `json:"proxy"`
+		Error    string `json:"error"`
+		Ts       int64  `json:"ts"`
 	}{
+		(*resultAlias)(res),
 		res.ProxyURL.String(),
-		res.Status,
-		res.TargetStatusCode,
-		res.ProxyStatusCode,
-		res.Latency,
-		res.ProxyServIPAddr,
-		res.ProxyNodeIPAddr,
 		errStr,
 		res.Ts.Unix(),
 	})
@@ -96,24 +170,32 @@ func (res *Result) EnrichHTTP(err error) error {
 		}
 	}
 	if res.RespPayload != "" {
-		if res.TargetURL.String() == "https://www.cloudflare.com/cdn-cgi/trace" {
-			for _, val := range strings.Split(res.RespPayload, "\n") {
-				if strings.HasPrefix(val, "ip=") {
-					res.ProxyNodeIPAddr = net.ParseIP(strings.Split(val, "=")[1])
-				}
+		res.ProxyNodeIPAddr = exitIPFromPayload(res.TargetURL.String(), res.RespPayload)
+	}
+	return nil
+}
+
+// Exit node IP address reported by IP echo target, nil for the unknown targets.
+// Reply that is a bare IP address, like the one of the judge /ip, is recognised for any target.
+func exitIPFromPayload(targetURL string, payload string) net.IP {
+	if targetURL == "https://www.cloudflare.com/cdn-cgi/trace" {
+		for _, val := range strings.Split(payload, "\n") {
+			if strings.HasPrefix(val, "ip=") {
+				return net.ParseIP(strings.Split(val, "=")[1])
 			}
-		} else if res.TargetURL.String() == "https://api.datascrape.tech/latest/ip" {
-			res.ProxyNodeIPAddr = net.ParseIP(res.RespPayload)
-		} else if res.TargetURL.String() == "https://icanhazip.com" || res.TargetURL.String() == "http://icanhazip.com" {
-			escaped := strings.ReplaceAll(res.RespPayload, "\n", "")
-			res.ProxyNodeIPAddr = net.ParseIP(escaped)
 		}
+	} else if targetURL == "https://api.datascrape.tech/latest/ip" {
+		return net.ParseIP(payload)
+	} else if targetURL == "https://icanhazip.com" || targetURL == "http://icanhazip.com" {
+		escaped := strings.ReplaceAll(payload, "\n", "")
+		return net.ParseIP(escaped)
 	}
-	return nil
+	return net.ParseIP(strings.TrimSpace(payload))
 }
 
 func (res *Result) EnrichUdpEcho(err error) error {
 	res.Error = PChickError{err}
+	res.Valid = res.Status
 	if res.RespPayload != "" {
 		if err != nil {
 			panic(err)
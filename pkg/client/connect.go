@@ -0,0 +1,62 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Proxy-Authorization header value for the credentials of proxyURL, empty if there are none.
+func proxyAuthHeader(proxyURL *url.URL) string {
+	if proxyURL.User == nil {
+		return ""
+	}
+	password, _ := proxyURL.User.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username()+":"+password))
+}
+
+type oneByteReader struct {
+	conn net.Conn
+}
+
+func (r oneByteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.conn.Read(p)
+}
+
+// Sends HTTP CONNECT request for targetAddr(host:port) over established conn and reads the proxy reply.
+// Response body is not read, non 200 status code is returned as error together with the response.
+func HTTPConnect(ctx context.Context, conn net.Conn, proxyURL *url.URL, targetAddr string) (*http.Response, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: targetAddr},
+		Host:   targetAddr,
+		Header: make(http.Header),
+	}
+	if auth := proxyAuthHeader(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, errors.New("http connect: Failed to send CONNECT request: " + err.Error())
+	}
+	// reading byte by byte, so the buffer won't swallow the first bytes sent by the target through the tunnel
+	resp, err := http.ReadResponse(bufio.NewReader(oneByteReader{conn}), req)
+	if err != nil {
+		return nil, errors.New("http connect: Failed to read CONNECT reply: " + err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, errors.New("http connect: " + resp.Status)
+	}
+	return resp, nil
+}
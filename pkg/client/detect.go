@@ -0,0 +1,279 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"github.com/go-gost/gosocks4"
+	"github.com/go-gost/gosocks5"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocols DetectProtocols can recognise.
+const (
+	ProtoHTTPConnect = "http-connect"
+	ProtoHTTPForward = "http-forward"
+	ProtoHTTPS       = "https"
+	ProtoSOCKS4      = "socks4"
+	ProtoSOCKS4A     = "socks4a" // SOCKS4 granted CONNECT to the target domain name
+	ProtoSOCKS5      = "socks5"
+	ProtoSOCKS5H     = "socks5h" // SOCKS5 granted CONNECT to the target domain name with the given credentials
+)
+
+// Detected protocol to proxy URL scheme, in order of preference.
+var DetectPreference = []struct {
+	Proto  string
+	Scheme string
+}{
+	{ProtoHTTPS, "https"},
+	{ProtoHTTPConnect, "http"},
+	{ProtoHTTPForward, "http"},
+	{ProtoSOCKS5H, "socks5h"},
+	{ProtoSOCKS5, "socks5"},
+	{ProtoSOCKS4A, "socks4a"},
+	{ProtoSOCKS4, "socks4"},
+}
+
+var socks5MethodNames = map[uint8]string{
+	gosocks5.MethodNoAuth:       "noauth",
+	gosocks5.MethodGSSAPI:       "gssapi",
+	gosocks5.MethodUserPass:     "userpass",
+	gosocks5.MethodNoAcceptable: "noacceptable",
+}
+
+// Handshake of a single protocol over its own connection, returns detected name and whether endpoint speaks the protocol.
+type detectProbe struct {
+	proto string
+	probe func(ctx context.Context, conn net.Conn) (string, bool)
+}
+
+// SOCKS5 auth methods probed one by one, each in its own greeting.
+var socks5ProbeMethods = []uint8{gosocks5.MethodNoAuth, gosocks5.MethodUserPass, gosocks5.MethodGSSAPI}
+
+// Probes proxy endpoint with lightweight handshakes of every supported protocol, all probes run concurrently.
+// Returns the list of protocols endpoint speaks, SOCKS5 is listed once per auth method proxy accepts(socks5:noacceptable if none),
+// and the traffic probes made. SOCKS4A and SOCKS5H are listed when the proxy resolved the target domain name itself,
+// TLS probe verifies the proxy with proxyTLS as the test does.
+func DetectProtocols(proxyURL *url.URL, targetURL *url.URL, timeOut time.Duration, proxyTLS *tls.Config) (StrList, Traffic) {
+	targetAddr := targetHostPort(targetURL)
+	if proxyTLS != nil {
+		proxyTLS = proxyTLS.Clone()
+	} else {
+		proxyTLS = &tls.Config{}
+	}
+	if proxyTLS.ServerName == "" {
+		proxyTLS.ServerName = proxyURL.Hostname()
+	}
+	probes := []detectProbe{
+		{ProtoHTTPConnect, func(ctx context.Context, conn net.Conn) (string, bool) {
+			return ProtoHTTPConnect, probeHTTPConnect(ctx, conn, proxyURL, targetAddr)
+		}},
+		{ProtoHTTPForward, func(ctx context.Context, conn net.Conn) (string, bool) {
+			return ProtoHTTPForward, probeHTTPForward(ctx, conn, proxyURL, targetURL)
+		}},
+		{ProtoHTTPS, func(ctx context.Context, conn net.Conn) (string, bool) {
+			tlsConn := tls.Client(conn, proxyTLS)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return ProtoHTTPS, false
+			}
+			return ProtoHTTPS, probeHTTPConnect(ctx, tlsConn, proxyURL, targetAddr)
+		}},
+		{ProtoSOCKS4, func(ctx context.Context, conn net.Conn) (string, bool) {
+			return ProtoSOCKS4, probeSOCKS4(ctx, conn, proxyURL, targetAddr)
+		}},
+		{ProtoSOCKS4A, func(ctx context.Context, conn net.Conn) (string, bool) {
+			return ProtoSOCKS4A, probeSOCKS4A(conn, proxyURL, targetAddr)
+		}},
+		{ProtoSOCKS5H, func(ctx context.Context, conn net.Conn) (string, bool) {
+			return ProtoSOCKS5H, probeSOCKS5H(conn, proxyURL, targetAddr)
+		}},
+	}
+	for _, method := range socks5ProbeMethods {
+		probes = append(probes, detectProbe{ProtoSOCKS5, func(ctx context.Context, conn net.Conn) (string, bool) {
+			accepted, ok := probeSOCKS5(conn, method)
+			if !accepted {
+				return ProtoSOCKS5 + ":" + socks5MethodNames[gosocks5.MethodNoAcceptable], ok
+			}
+			return ProtoSOCKS5 + ":" + socks5MethodNames[method], ok
+		}})
+	}
+	detected := make(map[int]string) // probe index to the detected name
+	traffic := &trafficCounter{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+			defer cancel()
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", proxyURL.Host)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn = traffic.wrap(conn, 0)
+			if deadline, ok := ctx.Deadline(); ok {
+				conn.SetDeadline(deadline)
+			}
+			if name, ok := p.probe(ctx, conn); ok {
+				mu.Lock()
+				detected[i] = name
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	rv := StrList{}
+	for _, pref := range DetectPreference {
+		names := StrList{}
+		for i, p := range probes {
+			if name, ok := detected[i]; ok && p.proto == pref.Proto && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		if noAcceptable := ProtoSOCKS5 + ":" + socks5MethodNames[gosocks5.MethodNoAcceptable]; len(names) > 1 {
+			names = slices.DeleteFunc(names, func(name string) bool { return name == noAcceptable })
+		}
+		rv = append(rv, names...)
+	}
+	return rv, traffic.traffic()
+}
+
+// Scheme of the most preferred protocol from DetectProtocols output the test can use, empty if there is none.
+// SOCKS5 is picked only if the proxy accepted the auth method the client offers with(userpass) or without(noauth) credentials.
+func BestDetectedScheme(detected StrList, withCreds bool) string {
+	for _, pref := range DetectPreference {
+		for _, d := range detected {
+			proto, method, _ := strings.Cut(d, ":")
+			if proto != pref.Proto {
+				continue
+			}
+			if proto == ProtoSOCKS5 && method != socks5MethodNames[gosocks5.MethodNoAuth] &&
+				!(withCreds && method == socks5MethodNames[gosocks5.MethodUserPass]) {
+				continue
+			}
+			return pref.Scheme
+		}
+	}
+	return ""
+}
+
+func targetHostPort(targetURL *url.URL) string {
+	if targetURL.Port() != "" {
+		return targetURL.Host
+	}
+	if targetURL.Scheme == "http" {
+		return net.JoinHostPort(targetURL.Hostname(), "80")
+	}
+	return net.JoinHostPort(targetURL.Hostname(), "443")
+}
+
+// Proxy speaks HTTP CONNECT if it either established the tunnel or asked for credentials.
+func probeHTTPConnect(ctx context.Context, conn net.Conn, proxyURL *url.URL, targetAddr string) bool {
+	resp, err := HTTPConnect(ctx, conn, proxyURL, targetAddr)
+	if resp == nil {
+		return false
+	}
+	return err == nil || resp.StatusCode == http.StatusProxyAuthRequired
+}
+
+// Proxy speaks forward HTTP if it answered absolute-URI GET with anything but a client error, or asked for credentials.
+func probeHTTPForward(ctx context.Context, conn net.Conn, proxyURL *url.URL, targetURL *url.URL) bool {
+	forwardURL := *targetURL
+	forwardURL.Scheme = "http"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, forwardURL.String(), nil)
+	if err != nil {
+		return false
+	}
+	if auth := proxyAuthHeader(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := req.WriteProxy(conn); err != nil {
+		return false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400 || resp.StatusCode == http.StatusProxyAuthRequired
+}
+
+// SOCKS4 server replies with 8 bytes starting from zero version byte, even if it rejects the request.
+// Target is resolved locally, as the plain SOCKS4 request carries IPv4 address only.
+func probeSOCKS4(ctx context.Context, conn net.Conn, proxyURL *url.URL, targetAddr string) bool {
+	addr, err := socksTargetAddr(ctx, "socks4", targetAddr)
+	if err != nil {
+		return false
+	}
+	reply, err := socks4Probe(conn, proxyURL, addr)
+	return err == nil && reply.Code >= gosocks4.Granted && reply.Code <= gosocks4.RejectedUserid
+}
+
+// SOCKS4A extension is there if the proxy granted CONNECT to the target domain name.
+func probeSOCKS4A(conn net.Conn, proxyURL *url.URL, targetAddr string) bool {
+	if host, _, err := net.SplitHostPort(targetAddr); err != nil || net.ParseIP(host) != nil {
+		return false
+	}
+	reply, err := socks4Probe(conn, proxyURL, targetAddr)
+	return err == nil && reply.Code == gosocks4.Granted
+}
+
+// Sends CONNECT request with the user ID of the proxy URL, the domain name is sent as is(SOCKS4A).
+func socks4Probe(conn net.Conn, proxyURL *url.URL, targetAddr string) (*gosocks4.Reply, error) {
+	host, sPort, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return nil, err
+	}
+	port, _ := strconv.Atoi(sPort)
+	addr := &gosocks4.Addr{Type: gosocks4.AddrDomain, Host: host, Port: uint16(port)}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		addr.Type = gosocks4.AddrIPv4
+	}
+	var userID []byte
+	if proxyURL.User != nil {
+		userID = []byte(proxyURL.User.Username())
+	}
+	if err := gosocks4.NewRequest(gosocks4.CmdConnect, addr, userID).Write(conn); err != nil {
+		return nil, err
+	}
+	return gosocks4.ReadReply(conn)
+}
+
+// Proxy resolves the domain names itself if it granted CONNECT to the target one after the usual greeting and auth.
+func probeSOCKS5H(conn net.Conn, proxyURL *url.URL, targetAddr string) bool {
+	if host, _, err := net.SplitHostPort(targetAddr); err != nil || net.ParseIP(host) != nil {
+		return false
+	}
+	trace := &SOCKSTrace{}
+	if err := socks5Greeting(conn, proxyURL, trace); err != nil {
+		return false
+	}
+	addr, err := gosocks5.NewAddr(targetAddr)
+	if err != nil {
+		return false
+	}
+	_, err = socks5Request(conn, gosocks5.CmdConnect, addr, trace)
+	return err == nil
+}
+
+// Offers the single auth method, ok is false unless endpoint replied as SOCKS5 server.
+func probeSOCKS5(conn net.Conn, method uint8) (accepted bool, ok bool) {
+	if _, err := conn.Write([]byte{gosocks5.Ver5, 1, method}); err != nil {
+		return false, false
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != gosocks5.Ver5 {
+		return false, false
+	}
+	return reply[1] == method, true
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/go-gost/gosocks5"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBestDetectedScheme(t *testing.T) {
+	cases := []struct {
+		name      string
+		detected  StrList
+		withCreds bool
+		scheme    string
+	}{
+		{"http preferred", StrList{"http-forward", "socks5:noauth"}, false, "http"},
+		{"noacceptable skipped", StrList{"socks5:noacceptable", "socks4"}, false, "socks4"},
+		{"noacceptable only", StrList{"socks5:noacceptable"}, true, ""},
+		{"userpass without creds", StrList{"socks5:userpass", "socks4"}, false, "socks4"},
+		{"userpass with creds", StrList{"socks5:userpass", "socks4"}, true, "socks5"},
+		{"noauth with creds", StrList{"socks5:noauth"}, true, "socks5"},
+		{"gssapi", StrList{"socks5:gssapi"}, false, ""},
+		{"remote DNS preferred", StrList{"socks5h", "socks5:noauth", "socks4a", "socks4"}, false, "socks5h"},
+		{"socks4a", StrList{"socks4a", "socks4"}, false, "socks4a"},
+		{"nothing", StrList{}, false, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := BestDetectedScheme(c.detected, c.withCreds); got != c.scheme {
+				t.Errorf("BestDetectedScheme(%v, %v) = %q, want %q", c.detected, c.withCreds, got, c.scheme)
+			}
+		})
+	}
+}
+
+func TestDetectProtocolsVerifiesProxyTLS(t *testing.T) {
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	// the other probes fail the handshake
+	proxy.Config.ErrorLog = log.New(io.Discard, "", 0)
+	proxy.StartTLS()
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	targetURL, _ := url.Parse("https://detect.test/")
+	roots := x509.NewCertPool()
+	roots.AddCert(proxy.Certificate())
+	trusted := &tls.Config{RootCAs: roots, ServerName: "example.com"}
+	for _, c := range []struct {
+		name     string
+		proxyTLS *tls.Config
+		https    bool
+	}{
+		{"untrusted certificate", nil, false},
+		{"trusted certificate", trusted, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			detected, _ := DetectProtocols(proxyURL, targetURL, 500*time.Millisecond, c.proxyTLS)
+			if got := slices.Contains(detected, ProtoHTTPS); got != c.https {
+				t.Errorf("DetectProtocols() = %v, https detected %v, want %v", detected, got, c.https)
+			}
+		})
+	}
+}
+
+// SOCKS5 server without auth, CONNECT to the domain name is granted only if it resolves them.
+func newSOCKS5Server(t *testing.T, remoteDNS bool) *url.URL {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := gosocks5.ReadMethods(conn); err != nil {
+					return
+				}
+				gosocks5.WriteMethod(gosocks5.MethodNoAuth, conn)
+				req, err := gosocks5.ReadRequest(conn)
+				if err != nil {
+					return
+				}
+				rep := uint8(gosocks5.Succeeded)
+				if req.Addr.Type == gosocks5.AddrDomain && !remoteDNS {
+					rep = gosocks5.AddrUnsupported
+				}
+				gosocks5.NewReply(rep, nil).Write(conn)
+			}()
+		}
+	}()
+	return &url.URL{Host: ln.Addr().String()}
+}
+
+func TestDetectProtocolsSOCKS5RemoteDNS(t *testing.T) {
+	targetURL, _ := url.Parse("http://localhost/")
+	for _, c := range []struct {
+		name      string
+		remoteDNS bool
+		detected  StrList
+		scheme    string
+	}{
+		{"local DNS", false, StrList{"socks5:noauth"}, "socks5"},
+		{"remote DNS", true, StrList{"socks5h", "socks5:noauth"}, "socks5h"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			detected, _ := DetectProtocols(newSOCKS5Server(t, c.remoteDNS), targetURL, time.Second, nil)
+			if !slices.Equal(detected, c.detected) {
+				t.Errorf("DetectProtocols() = %v, want %v", detected, c.detected)
+			}
+			if scheme := BestDetectedScheme(detected, false); scheme != c.scheme {
+				t.Errorf("BestDetectedScheme() = %q, want %q", scheme, c.scheme)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package client
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -11,16 +14,117 @@ import (
 	"time"
 )
 
-func TestHTTP(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, includeRespBody bool) (res *Result, err error) {
+// How HTTP(S) proxy is asked to reach the target.
+const (
+	ProxyModeAuto    = "auto"    // forward for http:// targets and CONNECT for https:// ones, as net/http does
+	ProxyModeForward = "forward" // absolute-URI request, proxy makes the request to the target itself
+	ProxyModeConnect = "connect" // CONNECT tunnel, the request goes to the target through it
+)
+
+var ProxyModes = []string{ProxyModeAuto, ProxyModeForward, ProxyModeConnect}
+
+// Context key of the proxy mode of the request, the dialer tells the forward requests from the tunneled ones by it.
+type proxyModeKey struct{}
+
+// Optional settings of the HTTP checker.
+type HTTPTestOpts struct {
+	ProxyTLS   *tls.Config // proxy leg of TLSCfg
+	TargetTLS  *tls.Config // TLS to the target, tunneled through the proxy
+	ProxyMode  string      // one of ProxyModes, empty is the same as auto
+	Request    *HTTPRequestCfg
+	Validator  *Validator  // response assertions, without it any response is valid
+	BlockRules *BlockRules // block/captcha page signatures
+	Redirects  *RedirectPolicy
+	Bandwidth  *BandwidthCfg
+	KeepAlive  *KeepAliveCfg
+	Timeouts   *HTTPTimeouts // per-phase budgets, nil means the checker timeout for each
+}
+
+// Writes absolute-URI request to the proxy connection and reads the response.
+func forwardRoundTrip(req *http.Request, proxyURL *url.URL, dialProxy func(ctx context.Context) (net.Conn, error), trace *httptrace.ClientTrace) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.Clone(ctx)
+	if auth := proxyAuthHeader(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	conn, err := dialProxy(ctx)
+	if err != nil {
+		cancel()
+		// the same error net/http reports, the exceeded budget stays reachable
+		return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	if err := req.WriteProxy(conn); err != nil {
+		cancel()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	if _, err := br.Peek(1); err != nil {
+		cancel()
+		return nil, err
+	}
+	trace.GotFirstResponseByte()
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// How HTTP(S) proxy is asked to reach reqURL in the given one of ProxyModes, empty for SOCKS.
+func resolveProxyMode(mode string, proxyURL *url.URL, reqURL *url.URL) string {
+	if IsSOCKS(proxyURL) {
+		return ""
+	}
+	if mode == "" || mode == ProxyModeAuto {
+		// net/http choice: absolute-URI request for plain HTTP targets and CONNECT tunnel for HTTPS ones
+		if reqURL.Scheme == "https" {
+			return ProxyModeConnect
+		}
+		return ProxyModeForward
+	}
+	return mode
+}
+
+// Requests the target through the proxy. Connect, proxy reply and target TLS phases, first byte and the whole request
+// have their own budgets(opts.Timeouts), the exceeded one is recorded into the result and reported as the error.
+func TestHTTP(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, includeRespBody bool, opts *HTTPTestOpts) (res *Result, err error) {
+	if opts == nil {
+		opts = &HTTPTestOpts{}
+	}
+	budgets := opts.Timeouts.resolve(timeOut)
 	res = &Result{}
 	res.Ts = time.Now()
 	var resp *http.Response
 	var AllStarted, DNSStarted, TcpConnStarted, tlsHandStarted time.Time
+	var ttfbTimer *time.Timer
 	res.ProxyURL = URL{*proxyURL}
-	res.TargetURL = *targetURL
+	res.TargetURL = URL{*targetURL}
 	res.Status = false
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
 
-	req, _ := http.NewRequest("GET", targetURL.String(), nil)
+	var req *http.Request
+	if opts.Request != nil {
+		if req, err = opts.Request.NewRequest(targetURL); err != nil {
+			return
+		}
+	} else {
+		req, _ = http.NewRequest("GET", targetURL.String(), nil)
+	}
 	clientTrace := &httptrace.ClientTrace{
 		DNSStart: func(info httptrace.DNSStartInfo) {
 			DNSStarted = time.Now()
@@ -44,20 +148,171 @@ func TestHTTP(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, incl
 		},
 		GotFirstResponseByte: func() {
 			res.Latency.TTFB = int(time.Since(AllStarted).Milliseconds())
+			if ttfbTimer != nil {
+				ttfbTimer.Stop()
+			}
 		},
 	}
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace))
+	// first byte and total budgets start with the request, the request context is cancelled with the exceeded one
+	reqCtx, cancelReq := context.WithCancelCause(req.Context())
+	defer cancelReq(nil)
+	defer func() {
+		if err = budgetErr(reqCtx, err); err != nil {
+			var exceeded *budgetExceeded
+			if errors.As(err, &exceeded) {
+				res.Timeout = exceeded.budget
+			}
+		}
+	}()
+	req = req.WithContext(httptrace.WithClientTrace(reqCtx, clientTrace))
+	var upMeter *throughputMeter
+	if opts.Bandwidth != nil {
+		if opts.Bandwidth.Upload > 0 {
+			upMeter = newThroughputMeter(io.LimitReader(payloadReader{}, opts.Bandwidth.Upload))
+			req.Body, req.GetBody, req.ContentLength = io.NopCloser(upMeter), nil, opts.Bandwidth.Upload
+			if opts.Request == nil || opts.Request.Method == "" {
+				req.Method = http.MethodPost
+			}
+		}
+	}
 	dialer := &net.Dialer{
-		Timeout:   timeOut,
 		KeepAlive: -1,
 	}
+	// all connections go to the proxy, so they are counted
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		connCtx, cancel := withBudget(ctx, TimeoutConnect, budgets.Connect)
+		defer cancel()
+		conn, err := dialer.DialContext(connCtx, network, addr)
+		if err != nil {
+			return nil, budgetErr(connCtx, err)
+		}
+		return traffic.wrap(conn, 0), nil
+	}
+	// dials the proxy server, wraps the connection into TLS for https:// proxies
+	dialProxy := func(ctx context.Context) (net.Conn, error) {
+		connCtx, cancel := withBudget(ctx, TimeoutConnect, budgets.Connect)
+		defer cancel()
+		conn, err := dial(connCtx, "tcp", proxyURL.Host)
+		if err != nil || proxyURL.Scheme != "https" {
+			return conn, err
+		}
+		var proxyTLS *tls.Config
+		if opts.ProxyTLS != nil {
+			proxyTLS = opts.ProxyTLS.Clone()
+		} else {
+			proxyTLS = &tls.Config{}
+		}
+		if proxyTLS.ServerName == "" {
+			proxyTLS.ServerName = proxyURL.Hostname()
+		}
+		tlsConn := tls.Client(conn, proxyTLS)
+		proxyTLSStarted := time.Now()
+		if err := tlsConn.HandshakeContext(connCtx); err != nil {
+			conn.Close()
+			return nil, budgetErr(connCtx, errors.New("c2p tls: "+err.Error()))
+		}
+		res.Latency.ProxyTLSHandshake = int(time.Since(proxyTLSStarted).Milliseconds())
+		return tlsConn, nil
+	}
+	// mode is resolved for each request, so the redirect btw http:// and https:// targets switches it in auto mode
+	requestMode := func(reqURL *url.URL) string {
+		return resolveProxyMode(opts.ProxyMode, proxyURL, reqURL)
+	}
+	var dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	transportProxy := func(req *http.Request) (*url.URL, error) {
+		if requestMode(req.URL) != ProxyModeForward {
+			return nil, nil
+		}
+		if proxyURL.Scheme == "https" {
+			// net/http reuses TLSClientConfig for the proxy leg, so the TLS session to the proxy is made by dialProxy
+			// and the transport is told to speak plain HTTP over it.
+			plainProxyURL := *proxyURL
+			plainProxyURL.Scheme = "http"
+			return &plainProxyURL, nil
+		}
+		return proxyURL, nil
+	}
+	if IsSOCKS(proxyURL) {
+		// net/http can't do SOCKS4 and hides SOCKS5 handshake, so the transport dials the target
+		// through our own SOCKS handshake instead of http.ProxyURL.
+		dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, proxyURL.Host)
+			if err != nil {
+				return nil, err
+			}
+			socksTrace := SOCKSTrace{}
+			replyCtx, cancel := withBudget(ctx, TimeoutProxyResp, budgets.ProxyResp)
+			defer cancel()
+			err = SOCKSHandshake(replyCtx, conn, proxyURL, addr, &socksTrace)
+			res.Latency.SOCKSGreeting = int(socksTrace.Greeting.Milliseconds())
+			res.Latency.SOCKSAuth = int(socksTrace.Auth.Milliseconds())
+			res.ProxySOCKSReply = socksTrace.Reply
+			if err != nil {
+				conn.Close()
+				return nil, budgetErr(replyCtx, err)
+			}
+			res.Latency.ProxyResp = int(time.Since(AllStarted).Milliseconds())
+			return conn, nil
+		}
+	} else {
+		dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if ctx.Value(proxyModeKey{}) == ProxyModeForward {
+				// transport dials the proxy itself for the absolute-URI request
+				return dialProxy(ctx)
+			}
+			// own CONNECT instead of the net/http one, because the later is never used for plain HTTP targets
+			conn, err := dialProxy(ctx)
+			if err != nil {
+				return nil, err
+			}
+			replyCtx, cancel := withBudget(ctx, TimeoutProxyResp, budgets.ProxyResp)
+			defer cancel()
+			connectRes, err := HTTPConnect(replyCtx, conn, proxyURL, addr)
+			if connectRes != nil {
+				res.Latency.ProxyResp = int(time.Since(AllStarted).Milliseconds())
+				res.ProxyStatusCode = connectRes.StatusCode
+				res.ProxyRespHeader = connectRes.Header
+			}
+			if err != nil {
+				conn.Close()
+				return nil, budgetErr(replyCtx, err)
+			}
+			return conn, nil
+		}
+	}
+	// TLS with the target is made here instead of net/http, so the handshake gets its own budget
+	dialTLSContext := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		var targetTLS *tls.Config
+		if opts.TargetTLS != nil {
+			targetTLS = opts.TargetTLS.Clone()
+		} else {
+			targetTLS = &tls.Config{}
+		}
+		if targetTLS.ServerName == "" {
+			targetTLS.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsCtx, cancel := withBudget(ctx, TimeoutTLS, budgets.TLS)
+		defer cancel()
+		tlsConn := tls.Client(conn, targetTLS)
+		clientTrace.TLSHandshakeStart()
+		err = tlsConn.HandshakeContext(tlsCtx)
+		clientTrace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+		if err != nil {
+			conn.Close()
+			return nil, budgetErr(tlsCtx, err)
+		}
+		return tlsConn, nil
+	}
 	transport := http.Transport{
-		Proxy:                 http.ProxyURL(proxyURL),
-		DialContext:           dialer.DialContext,
-		TLSHandshakeTimeout:   timeOut,
-		ResponseHeaderTimeout: timeOut,
-		ExpectContinueTimeout: timeOut,
-		DisableKeepAlives:     true,
+		Proxy:                 transportProxy,
+		DialContext:           dialContext,
+		DialTLSContext:        dialTLSContext,
+		ExpectContinueTimeout: budgets.TTFB,
+		DisableKeepAlives:     opts.KeepAlive == nil,
 		MaxIdleConns:          0,
 		MaxConnsPerHost:       0,
 		OnProxyConnectResponse: func(_ context.Context, _ *url.URL, connectReq *http.Request, connectRes *http.Response) error {
@@ -68,23 +323,147 @@ func TestHTTP(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, incl
 			return nil
 		},
 	}
+	if opts.KeepAlive != nil && requestMode(targetURL) == ProxyModeForward && targetURL.Scheme == "https" {
+		err = errors.New("keepalive: Not supported in forward mode for https targets")
+		return
+	}
+	roundTrip := func(req *http.Request) (*http.Response, error) {
+		res.ProxyMode = requestMode(req.URL)
+		if res.ProxyMode == ProxyModeForward && req.URL.Scheme == "https" {
+			// net/http always tunnels HTTPS, absolute-URI request with https scheme is written by hand
+			return forwardRoundTrip(req, proxyURL, dialProxy, clientTrace)
+		}
+		return transport.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyModeKey{}, res.ProxyMode)))
+	}
 	AllStarted = time.Now()
-	if resp, err = transport.RoundTrip(req); err != nil {
+	ttfbTimer = time.AfterFunc(budgets.TTFB, func() { cancelReq(&budgetExceeded{TimeoutTTFB}) })
+	defer ttfbTimer.Stop()
+	totalTimer := time.AfterFunc(budgets.Total, func() { cancelReq(&budgetExceeded{TimeoutTotal}) })
+	defer totalTimer.Stop()
+	resp, err = roundTrip(req)
+	if err != nil {
 		res.TargetStatusCode = 0 // JQuery and YandexTank(Phantom) do the same for transport layer errors
 		return
 	}
+	if opts.Redirects != nil {
+		// latency breakdown is kept for the first request, the later ones are reported by the hops
+		firstLatency := res.Latency
+		res.RedirectChain = RedirectChain{{URL{*req.URL}, resp.StatusCode, int(time.Since(AllStarted).Milliseconds()), res.ProxyMode}}
+		for nextURL := opts.Redirects.next(resp, req.URL, targetURL, 0); nextURL != nil; nextURL = opts.Redirects.next(resp, req.URL, targetURL, res.RedirectCnt) {
+			resp.Body.Close()
+			if req, err = redirectRequest(req, resp.StatusCode, nextURL, opts.Request); err != nil {
+				break
+			}
+			res.RedirectCnt++
+			hopStarted := time.Now()
+			resp, err = roundTrip(req)
+			hop := RedirectHop{URL: URL{*nextURL}, Latency: int(time.Since(hopStarted).Milliseconds()), ProxyMode: res.ProxyMode}
+			if err == nil {
+				hop.StatusCode = resp.StatusCode
+			}
+			res.RedirectChain = append(res.RedirectChain, hop)
+			if err != nil {
+				break
+			}
+		}
+		res.Latency = firstLatency
+		if err != nil {
+			res.TargetStatusCode = 0
+			return
+		}
+	}
 
-	if includeRespBody && resp.Body != nil {
-		b, err := ioutil.ReadAll(resp.Body)
+	var body []byte
+	var bodyReader io.Reader = resp.Body
+	var downMeter *throughputMeter
+	if opts.Bandwidth != nil {
+		downMeter = newThroughputMeter(resp.Body)
+		bodyReader = downMeter
+	}
+	if (includeRespBody || opts.Validator != nil || opts.BlockRules != nil) && resp.Body != nil {
+		if downMeter != nil {
+			// the checks get the head of the download, it isn't kept in memory
+			bodyReader = io.LimitReader(bodyReader, bandwidthBodyHead)
+		} else if opts.Validator != nil && opts.Validator.BodyReadLimit() > 0 {
+			bodyReader = io.LimitReader(bodyReader, opts.Validator.BodyReadLimit())
+		}
+		b, err := ioutil.ReadAll(bodyReader)
+		if err != nil && context.Cause(reqCtx) != nil {
+			// total budget covers the body as well
+			resp.Body.Close()
+			res.TargetStatusCode = resp.StatusCode
+			return res, err
+		}
 		if err != nil {
 			res.RespPayload = "N/A"
 		} else {
-			res.RespPayload = string(b)
+			body = b
+			if downMeter != nil {
+				res.ProxyNodeIPAddr = exitIPFromPayload(targetURL.String(), string(b))
+			} else if includeRespBody {
+				res.RespPayload = string(b)
+			}
+		}
+	}
+	if downMeter != nil {
+		// the rest of the reply the checks above didn't need
+		_, err = io.Copy(io.Discard, downMeter)
+		res.Latency.TTLB = int(time.Since(AllStarted).Milliseconds())
+		res.Throughput.BytesDown = downMeter.n
+		res.Throughput.DownAvg, res.Throughput.DownPeak = downMeter.rates()
+		if upMeter != nil {
+			res.Throughput.BytesUp = upMeter.n
+			res.Throughput.UpAvg, res.Throughput.UpPeak = upMeter.rates()
+		}
+		if err != nil {
+			resp.Body.Close()
+			res.TargetStatusCode = resp.StatusCode
+			err = errors.New("bandwidth: Download interrupted: " + err.Error())
+			return
 		}
 	}
+	if opts.KeepAlive != nil {
+		// connection is returned to the pool only after the reply is read to the end
+		io.Copy(io.Discard, resp.Body)
+	}
 	resp.Body.Close()
+	if res.ProxyMode == ProxyModeForward {
+		// there is no separate proxy reply in forward mode, its headers are mixed into the target ones
+		res.ProxyRespHeader = resp.Header
+	}
 
 	res.TargetStatusCode = resp.StatusCode
 	res.Status = true
+	if opts.Validator != nil {
+		bodySize := int64(len(body))
+		if downMeter != nil {
+			bodySize = downMeter.n
+		}
+		res.ValidationErrors = opts.Validator.Validate(resp, body, bodySize)
+	}
+	res.Valid = len(res.ValidationErrors) == 0
+	if opts.BlockRules != nil {
+		res.BlockStatus, res.BlockRule = opts.BlockRules.Classify(req.URL.Hostname(), resp, body)
+	}
+	if opts.KeepAlive != nil {
+		// the first request is over, the rest have their own budgets
+		totalTimer.Stop()
+		// latency breakdown is kept for the first(cold) request, reconnects would overwrite it
+		firstLatency := res.Latency
+		newRequest := func() (*http.Request, error) {
+			if opts.Request != nil {
+				return opts.Request.NewRequest(targetURL)
+			}
+			return http.NewRequest("GET", targetURL.String(), nil)
+		}
+		err = runKeepAlive(roundTrip, newRequest, targetURL, body, budgets.Total, opts.KeepAlive, &res.KeepAlive)
+		res.Latency = firstLatency
+		if err != nil {
+			// test fails with the failed request even though the first one succeeded
+			res.Status = false
+			res.Valid = false
+		}
+		transport.CloseIdleConnections()
+	}
 	return
 }
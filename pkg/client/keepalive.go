@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Head of the reply to the request after the first one read for the exit IP.
+const keepAliveBodyHead = 16 << 10
+
+// Keep-alive mode of the HTTP checker: sequential requests over one proxied connection.
+type KeepAliveCfg struct {
+	Requests int // per test, the first one included
+}
+
+type KeepAliveStats struct {
+	Requests      int     `csv:"requests" json:"requests"`           // completed requests, the first one included
+	Reconnects    int     `csv:"reconnects" json:"reconnects"`       // requests after the first one that couldn't reuse the connection
+	WarmTTFB      IntList `csv:"warmTtfb" json:"warmTtfb"`           // TTFB of each request that reused the connection(ms)
+	ExitIPChanges int     `csv:"exitIpChanges" json:"exitIpChanges"` // requests whose exit IP differs from the previous one
+}
+
+// Sends the requests after the first one through roundTrip, which keeps the connection of the first request.
+// Each of them is limited by budget including its body, the exceeded one is reported as TimeoutWarm.
+// firstBody is the reply to the first request, exit IPs are compared for the IP echo targets only.
+func runKeepAlive(roundTrip func(*http.Request) (*http.Response, error), newRequest func() (*http.Request, error), targetURL *url.URL, firstBody []byte, budget time.Duration, cfg *KeepAliveCfg, stats *KeepAliveStats) error {
+	stats.Requests = 1
+	stats.WarmTTFB = IntList{}
+	prevIP := exitIPFromPayload(targetURL.String(), string(firstBody))
+	for i := 2; i <= cfg.Requests; i++ {
+		if err := keepAliveRequest(roundTrip, newRequest, targetURL, budget, i, &prevIP, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends the request number i and records it into stats.
+func keepAliveRequest(roundTrip func(*http.Request) (*http.Response, error), newRequest func() (*http.Request, error), targetURL *url.URL, budget time.Duration, i int, prevIP *net.IP, stats *KeepAliveStats) error {
+	req, err := newRequest()
+	if err != nil {
+		return err
+	}
+	reqCtx, cancel := context.WithTimeoutCause(req.Context(), budget, &budgetExceeded{TimeoutWarm})
+	defer cancel()
+	failed := func(err error) error {
+		var exceeded *budgetExceeded
+		if err = budgetErr(reqCtx, err); errors.As(err, &exceeded) {
+			return err
+		}
+		return errors.New("keepalive: Request " + strconv.Itoa(i) + " failed: " + err.Error())
+	}
+	var reused bool
+	var firstByte time.Time
+	req = req.WithContext(httptrace.WithClientTrace(reqCtx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		},
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+		},
+	}))
+	started := time.Now()
+	resp, err := roundTrip(req)
+	if err != nil {
+		return failed(err)
+	}
+	// exit IP is in the head of the reply, the rest is drained, so the connection can be reused
+	body, err := io.ReadAll(io.LimitReader(resp.Body, keepAliveBodyHead))
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+	}
+	resp.Body.Close()
+	if err != nil {
+		return failed(err)
+	}
+	stats.Requests++
+	if reused {
+		stats.WarmTTFB = append(stats.WarmTTFB, int(firstByte.Sub(started).Milliseconds()))
+	} else {
+		// reconnected request is a cold one
+		stats.Reconnects++
+	}
+	if ip := exitIPFromPayload(targetURL.String(), string(body)); ip != nil {
+		if *prevIP != nil && !ip.Equal(*prevIP) {
+			stats.ExitIPChanges++
+		}
+		*prevIP = ip
+	}
+	return nil
+}
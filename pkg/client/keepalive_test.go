@@ -0,0 +1,56 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveStalledBody(t *testing.T) {
+	var requests atomic.Int32
+	proxyURL := newForwardProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Write([]byte("127.0.0.1"))
+			return
+		}
+		// headers and the head of the body, then the proxy stalls
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("127.0."))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+	targetURL, _ := url.Parse("http://keepalive.test/ip")
+	started := time.Now()
+	res, err := TestHTTP(targetURL, proxyURL, time.Second, true, &HTTPTestOpts{KeepAlive: &KeepAliveCfg{Requests: 3}})
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Fatalf("TestHTTP() took %v with 1s timeout", elapsed)
+	}
+	if err == nil || err.Error() != "timeout: warm budget exceeded" {
+		t.Errorf("TestHTTP() error = %v, want warm budget exceeded", err)
+	}
+	if res.Status || res.Timeout != TimeoutWarm {
+		t.Errorf("Status = %v, Timeout = %q, want false, %q", res.Status, res.Timeout, TimeoutWarm)
+	}
+	if res.KeepAlive.Requests != 1 {
+		t.Errorf("KeepAlive.Requests = %d, want 1", res.KeepAlive.Requests)
+	}
+}
+
+func TestKeepAliveReused(t *testing.T) {
+	proxyURL := newForwardProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("127.0.0.1"))
+	})
+	targetURL, _ := url.Parse("http://keepalive.test/ip")
+	res, err := TestHTTP(targetURL, proxyURL, time.Second, true, &HTTPTestOpts{KeepAlive: &KeepAliveCfg{Requests: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Status || res.KeepAlive.Requests != 3 || len(res.KeepAlive.WarmTTFB) != 2 || res.KeepAlive.Reconnects != 0 {
+		t.Errorf("Status = %v, KeepAlive = %+v, want 3 requests over one connection", res.Status, res.KeepAlive)
+	}
+}
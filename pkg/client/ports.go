@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Settings of the destination port policy audit.
+type PortAuditOpts struct {
+	Ports    []int       // tried in this order on the target host
+	ProxyTLS *tls.Config // proxy leg of TLSCfg
+}
+
+type PortAuditStats struct {
+	Allowed IntList `csv:"allowed" json:"allowed"` // tunnel was established and the probe echoed
+	Denied  IntList `csv:"denied" json:"denied"`   // proxy refused the CONNECT or closed the tunnel
+	Failed  IntList `csv:"failed" json:"failed"`   // proxy wasn't reached or the probe timed out
+}
+
+// Opens a tunnel to the port of the echo target and checks the probe comes back.
+// denied is true if the proxy refused the tunnel or closed it, false for other errors.
+func auditPort(host string, port int, proxyURL *url.URL, timeOut time.Duration, opts *PortAuditOpts, traffic *trafficCounter, portRes *Result) (denied bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	conn, err := dialTunnel(ctx, proxyURL, net.JoinHostPort(host, strconv.Itoa(port)), opts.ProxyTLS, traffic, portRes)
+	if err != nil {
+		// the proxy replied to CONNECT, but not with success, rejected credentials aren't the port policy
+		refused := portRes.ProxyStatusCode != 0 && portRes.ProxyStatusCode != http.StatusProxyAuthRequired
+		return refused || portRes.ProxySOCKSReply != "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	probe := []byte("proxychick port " + strconv.Itoa(port) + "\n")
+	echo := make([]byte, len(probe))
+	if _, err = conn.Write(probe); err == nil {
+		_, err = io.ReadFull(conn, echo)
+	}
+	if err != nil {
+		drop := tunnelDropReason(err)
+		return drop == TunnelDropEOF || drop == TunnelDropReset, err
+	}
+	if !bytes.Equal(probe, echo) {
+		return false, errors.New("ports: Probe echo mismatch")
+	}
+	portRes.Latency.TTFB = int(time.Since(portRes.Ts).Milliseconds())
+	return false, nil
+}
+
+// Tries each port of opts through the proxy against the multi-port echo target(tcp://host), port of the target URL is ignored.
+// Result is successful if the proxy answered for any port and valid if all ports are allowed.
+// Latency and proxy reply are the ones of the first allowed port.
+func TestPorts(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, opts *PortAuditOpts) (res *Result, err error) {
+	res = &Result{}
+	res.Ts = time.Now()
+	res.ProxyURL = URL{*proxyURL}
+	res.TargetURL = URL{*targetURL}
+	res.Ports = PortAuditStats{Allowed: IntList{}, Denied: IntList{}, Failed: IntList{}}
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
+
+	var lastErr error
+	reported := false
+	for _, port := range opts.Ports {
+		portRes := &Result{Ts: time.Now()}
+		denied, portErr := auditPort(targetURL.Hostname(), port, proxyURL, timeOut, opts, traffic, portRes)
+		switch {
+		case portErr == nil:
+			res.Ports.Allowed = append(res.Ports.Allowed, port)
+		case denied:
+			res.Ports.Denied = append(res.Ports.Denied, port)
+		default:
+			res.Ports.Failed = append(res.Ports.Failed, port)
+			lastErr = portErr
+		}
+		if portRes.ProxyServIPAddr != nil && !reported && (portErr == nil || port == opts.Ports[len(opts.Ports)-1]) {
+			// the first allowed port, or the last one if none is allowed
+			reported = true
+			res.Latency = portRes.Latency
+			res.ProxyServIPAddr = portRes.ProxyServIPAddr
+			res.ProxyStatusCode = portRes.ProxyStatusCode
+			res.ProxySOCKSReply = portRes.ProxySOCKSReply
+			res.ProxyMode = portRes.ProxyMode
+		}
+	}
+	if len(res.Ports.Allowed) == 0 && len(res.Ports.Denied) == 0 {
+		err = lastErr
+		return
+	}
+	res.Status = true
+	res.Valid = len(res.Ports.Allowed) == len(opts.Ports)
+	return
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redirect following of the HTTP checker, without it 3xx reply of the target is the final one.
+type RedirectPolicy struct {
+	MaxHops  int  // redirects to follow at most
+	SameHost bool // stop at redirects to another host
+}
+
+// Request of the redirect chain.
+type RedirectHop struct {
+	URL        URL    `json:"url"`
+	StatusCode int    `json:"statusCode"`          // 0 if the hop failed
+	Latency    int    `json:"latency"`             // ms btw the start of the hop request and the reply headers
+	ProxyMode  string `json:"proxyMode,omitempty"` // how HTTP(S) proxy was asked to reach the hop URL, empty for SOCKS
+}
+
+// Every request made to reach the target, the first one goes to the target URL itself.
+type RedirectChain []RedirectHop
+
+func (c RedirectChain) MarshalCSV() (string, error) {
+	hops := make([]string, len(c))
+	for i, hop := range c {
+		hops[i] = fmt.Sprintf("%d %s %dms", hop.StatusCode, hop.URL.String(), hop.Latency)
+		if hop.ProxyMode != "" {
+			hops[i] += " " + hop.ProxyMode
+		}
+	}
+	return strings.Join(hops, " > "), nil
+}
+
+// Returns the URL the reply redirects to, nil if there is nothing to follow or the policy stops the chain.
+func (p *RedirectPolicy) next(resp *http.Response, reqURL, targetURL *url.URL, hops int) *url.URL {
+	if hops >= p.MaxHops {
+		return nil
+	}
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil
+	}
+	nextURL, err := reqURL.Parse(location)
+	if err != nil || (nextURL.Scheme != "http" && nextURL.Scheme != "https") {
+		return nil
+	}
+	if p.SameHost && nextURL.Hostname() != targetURL.Hostname() {
+		return nil
+	}
+	return nextURL
+}
+
+// Request to the next hop. 301, 302 and 303 turn non GET/HEAD requests into body-less GET as browsers do,
+// Host override and User-Agent of the previous request are kept.
+func redirectRequest(prev *http.Request, statusCode int, nextURL *url.URL, cfg *HTTPRequestCfg) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if cfg != nil {
+		req, err = cfg.NewRequest(nextURL)
+	} else {
+		req, err = http.NewRequest(http.MethodGet, nextURL.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusTemporaryRedirect && statusCode != http.StatusPermanentRedirect &&
+		req.Method != http.MethodGet && req.Method != http.MethodHead {
+		req.Method = http.MethodGet
+		req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+		req.Header.Del("Content-Type")
+	}
+	if nextURL.Host != prev.URL.Host {
+		req.Host = ""
+	}
+	if ua := prev.Header.Get("User-Agent"); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	return req.WithContext(prev.Context()), nil
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Proxy doing both forward requests and CONNECT tunnels, tunnels lead to tunnelTo whatever the requested address is.
+func newTunnelingProxy(t *testing.T, tunnelTo string, forward http.HandlerFunc) (*url.URL, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	proxyURL := newForwardProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.RequestURI)
+		mu.Unlock()
+		if r.Method != http.MethodConnect {
+			forward(w, r)
+			return
+		}
+		upstream, err := net.Dial("tcp", tunnelTo)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	})
+	return proxyURL, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, seen...)
+	}
+}
+
+func TestRedirectToHTTPSAutoMode(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	proxyURL, seen := newTunnelingProxy(t, target.Listener.Addr().String(), func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://redirect.test/", http.StatusMovedPermanently)
+	})
+	targetURL, _ := url.Parse("http://redirect.test/")
+	res, err := TestHTTP(targetURL, proxyURL, 5*time.Second, true, &HTTPTestOpts{
+		ProxyMode: ProxyModeAuto,
+		Redirects: &RedirectPolicy{MaxHops: 3},
+		TargetTLS: &tls.Config{InsecureSkipVerify: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := seen(); len(got) != 2 || got[0] != "GET http://redirect.test/" || got[1] != "CONNECT redirect.test:443" {
+		t.Errorf("proxy saw %v, want forward GET and then CONNECT", got)
+	}
+	if res.TargetStatusCode != http.StatusOK || res.ProxyMode != ProxyModeConnect {
+		t.Errorf("TargetStatusCode = %d, ProxyMode = %q, want 200, %q", res.TargetStatusCode, res.ProxyMode, ProxyModeConnect)
+	}
+	chain, _ := res.RedirectChain.MarshalCSV()
+	if len(res.RedirectChain) != 2 || res.RedirectChain[0].ProxyMode != ProxyModeForward || res.RedirectChain[1].ProxyMode != ProxyModeConnect {
+		t.Errorf("RedirectChain = %s, want forward hop and then connect one", chain)
+	}
+}
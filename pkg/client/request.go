@@ -0,0 +1,100 @@
+package client
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// HTTP request TestHTTP sends to the target. Zero value is a bare GET with Go default User-Agent.
+type HTTPRequestCfg struct {
+	Method         string            `yaml:"method" json:"method"`
+	Headers        map[string]string `yaml:"headers" json:"headers"` // "Host" overrides the Host header
+	Body           string            `yaml:"body" json:"body"`
+	BodyFile       string            `yaml:"bodyFile" json:"bodyFile"`
+	UserAgents     []string          `yaml:"userAgents" json:"userAgents"` // random one is picked for each request
+	UserAgentsFile string            `yaml:"userAgentsFile" json:"userAgentsFile"`
+}
+
+// Reads BodyFile and UserAgentsFile(one User-Agent per line) into Body and UserAgents, file paths are cleared after that.
+func (c *HTTPRequestCfg) Load() error {
+	if c.BodyFile != "" {
+		body, err := os.ReadFile(c.BodyFile)
+		if err != nil {
+			return errors.New("request: Can't read body file " + c.BodyFile + ": " + err.Error())
+		}
+		c.Body = string(body)
+		c.BodyFile = ""
+	}
+	if c.UserAgentsFile != "" {
+		content, err := os.ReadFile(c.UserAgentsFile)
+		if err != nil {
+			return errors.New("request: Can't read User-Agents file " + c.UserAgentsFile + ": " + err.Error())
+		}
+		for _, ua := range strings.Split(string(content), "\n") {
+			if ua = strings.TrimSpace(ua); ua != "" {
+				c.UserAgents = append(c.UserAgents, ua)
+			}
+		}
+		c.UserAgentsFile = ""
+	}
+	if c.Method != "" && strings.ContainsAny(c.Method, " \t\r\n") {
+		return errors.New("request: Invalid method " + c.Method)
+	}
+	return nil
+}
+
+// Values of other set over the ones of c.
+func (c HTTPRequestCfg) Merge(other HTTPRequestCfg) HTTPRequestCfg {
+	if other.Method != "" {
+		c.Method = other.Method
+	}
+	if len(other.Headers) > 0 {
+		headers := make(map[string]string)
+		for k, v := range c.Headers {
+			headers[k] = v
+		}
+		for k, v := range other.Headers {
+			headers[k] = v
+		}
+		c.Headers = headers
+	}
+	if other.Body != "" || other.BodyFile != "" {
+		c.Body, c.BodyFile = other.Body, other.BodyFile
+	}
+	if len(other.UserAgents) > 0 || other.UserAgentsFile != "" {
+		c.UserAgents, c.UserAgentsFile = other.UserAgents, other.UserAgentsFile
+	}
+	return c
+}
+
+func (c *HTTPRequestCfg) NewRequest(targetURL *url.URL) (*http.Request, error) {
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var req *http.Request
+	var err error
+	if c.Body != "" {
+		req, err = http.NewRequest(method, targetURL.String(), strings.NewReader(c.Body))
+	} else {
+		req, err = http.NewRequest(method, targetURL.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, val := range c.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = val
+		} else {
+			req.Header.Set(name, val)
+		}
+	}
+	if len(c.UserAgents) > 0 {
+		req.Header.Set("User-Agent", c.UserAgents[rand.IntN(len(c.UserAgents))])
+	}
+	return req, nil
+}
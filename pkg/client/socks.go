@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-gost/gosocks4"
+	"github.com/go-gost/gosocks5"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var SOCKSSchemes = []string{"socks4", "socks4a", "socks5", "socks5h"}
+
+var socks5ReplyNames = map[uint8]string{
+	gosocks5.Succeeded:       "succeeded",
+	gosocks5.Failure:         "general failure",
+	gosocks5.NotAllowed:      "not allowed by ruleset",
+	gosocks5.NetUnreachable:  "network unreachable",
+	gosocks5.HostUnreachable: "host unreachable",
+	gosocks5.ConnRefused:     "connection refused",
+	gosocks5.TTLExpired:      "TTL expired",
+	gosocks5.CmdUnsupported:  "command not supported",
+	gosocks5.AddrUnsupported: "address type not supported",
+}
+
+var socks5CmdNames = map[uint8]string{
+	gosocks5.CmdConnect: "CONNECT",
+	gosocks5.CmdUdp:     "UDP ASSOCIATE",
+}
+
+var socks4ReplyNames = map[uint8]string{
+	gosocks4.Granted:        "granted",
+	gosocks4.Failed:         "rejected or failed",
+	gosocks4.Rejected:       "identd unreachable",
+	gosocks4.RejectedUserid: "identd userid mismatch",
+}
+
+// Timings and reply of the SOCKS handshake.
+type SOCKSTrace struct {
+	Greeting time.Duration // SOCKS5 method selection round trip
+	Auth     time.Duration // SOCKS5 username/password sub-negotiation round trip
+	Reply    string        // reply code and its name, e.g. "0 succeeded" or "91 rejected or failed"
+	Methods  []uint8       // auth methods the client offered
+	Method   uint8         // auth method selected by the proxy
+}
+
+func IsSOCKS(proxyURL *url.URL) bool {
+	return strings.HasPrefix(proxyURL.Scheme, "socks")
+}
+
+// Resolve the host locally for the schemes without remote DNS resolution(socks4, socks5).
+func socksTargetAddr(ctx context.Context, scheme string, targetAddr string) (string, error) {
+	if scheme != "socks4" && scheme != "socks5" {
+		return targetAddr, nil
+	}
+	host, port, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return targetAddr, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if scheme == "socks5" || ip.IP.To4() != nil {
+			return net.JoinHostPort(ip.IP.String(), port), nil
+		}
+	}
+	return "", errors.New("socks4: No IPv4 address for " + host)
+}
+
+// Performs SOCKS handshake over established conn and asks the proxy to CONNECT to targetAddr(host:port).
+func SOCKSHandshake(ctx context.Context, conn net.Conn, proxyURL *url.URL, targetAddr string, trace *SOCKSTrace) error {
+	if trace == nil {
+		trace = &SOCKSTrace{}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	addr, err := socksTargetAddr(ctx, proxyURL.Scheme, targetAddr)
+	if err != nil {
+		return err
+	}
+	switch proxyURL.Scheme {
+	case "socks4", "socks4a":
+		return socks4Handshake(conn, proxyURL, addr, trace)
+	case "socks5", "socks5h":
+		return socks5Handshake(conn, proxyURL, addr, trace)
+	}
+	return errors.New("socks: Unsupported proxy scheme " + proxyURL.Scheme)
+}
+
+func socks4Handshake(conn net.Conn, proxyURL *url.URL, targetAddr string, trace *SOCKSTrace) error {
+	host, sPort, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(sPort)
+	if err != nil {
+		return err
+	}
+	addr := &gosocks4.Addr{Type: gosocks4.AddrIPv4, Host: host, Port: uint16(port)}
+	if net.ParseIP(host) == nil {
+		addr.Type = gosocks4.AddrDomain
+	}
+	var userID []byte
+	if proxyURL.User != nil {
+		userID = []byte(proxyURL.User.Username())
+	}
+	if err := gosocks4.NewRequest(gosocks4.CmdConnect, addr, userID).Write(conn); err != nil {
+		return errors.New("socks4: Failed to send CONNECT request: " + err.Error())
+	}
+	reply, err := gosocks4.ReadReply(conn)
+	if err != nil {
+		return errors.New("socks4: Failed to read CONNECT reply: " + err.Error())
+	}
+	trace.Reply = fmt.Sprintf("%d %s", reply.Code, socks4ReplyNames[reply.Code])
+	if reply.Code != gosocks4.Granted {
+		return errors.New("socks4: CONNECT " + socks4ReplyNames[reply.Code])
+	}
+	return nil
+}
+
+func socks5Handshake(conn net.Conn, proxyURL *url.URL, targetAddr string, trace *SOCKSTrace) error {
+	if err := socks5Greeting(conn, proxyURL, trace); err != nil {
+		return err
+	}
+	addr, err := gosocks5.NewAddr(targetAddr)
+	if err != nil {
+		return err
+	}
+	_, err = socks5Request(conn, gosocks5.CmdConnect, addr, trace)
+	return err
+}
+
+// Method selection followed by username/password sub-negotiation if the proxy asks for it.
+func socks5Greeting(conn net.Conn, proxyURL *url.URL, trace *SOCKSTrace) error {
+	trace.Methods = []uint8{gosocks5.MethodNoAuth}
+	if proxyURL.User != nil {
+		trace.Methods = append(trace.Methods, gosocks5.MethodUserPass)
+	}
+	greetingStarted := time.Now()
+	if _, err := conn.Write(append([]byte{gosocks5.Ver5, uint8(len(trace.Methods))}, trace.Methods...)); err != nil {
+		return errors.New("socks5: Failed to send greeting: " + err.Error())
+	}
+	methodReply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, methodReply); err != nil {
+		return errors.New("socks5: Failed to read greeting reply: " + err.Error())
+	}
+	trace.Greeting = time.Since(greetingStarted)
+	if methodReply[0] != gosocks5.Ver5 {
+		return errors.New("socks5: Bad protocol version in greeting reply")
+	}
+	trace.Method = methodReply[1]
+	switch trace.Method {
+	case gosocks5.MethodNoAuth:
+	case gosocks5.MethodUserPass:
+		if proxyURL.User == nil {
+			return errors.New("socks5: Proxy requires username/password")
+		}
+		password, _ := proxyURL.User.Password()
+		authStarted := time.Now()
+		if err := gosocks5.NewUserPassRequest(gosocks5.UserPassVer, proxyURL.User.Username(), password).Write(conn); err != nil {
+			return errors.New("socks5: Failed to send credentials: " + err.Error())
+		}
+		authReply, err := gosocks5.ReadUserPassResponse(conn)
+		if err != nil {
+			return errors.New("socks5: Failed to read auth reply: " + err.Error())
+		}
+		trace.Auth = time.Since(authStarted)
+		if authReply.Status != gosocks5.Succeeded {
+			return errors.New("socks5: Auth failure")
+		}
+	case gosocks5.MethodNoAcceptable:
+		return errors.New("socks5: No acceptable auth methods")
+	default:
+		return fmt.Errorf("socks5: Unsupported auth method %d", trace.Method)
+	}
+	return nil
+}
+
+// Sends the command request and reads its reply, reply address is the one the proxy bound for the command.
+func socks5Request(conn net.Conn, cmd uint8, addr *gosocks5.Addr, trace *SOCKSTrace) (*gosocks5.Reply, error) {
+	if err := gosocks5.NewRequest(cmd, addr).Write(conn); err != nil {
+		return nil, errors.New("socks5: Failed to send " + socks5CmdNames[cmd] + " request: " + err.Error())
+	}
+	reply, err := gosocks5.ReadReply(conn)
+	if err != nil {
+		return nil, errors.New("socks5: Failed to read " + socks5CmdNames[cmd] + " reply: " + err.Error())
+	}
+	trace.Reply = fmt.Sprintf("%d %s", reply.Rep, socks5ReplyNames[reply.Rep])
+	if reply.Rep != gosocks5.Succeeded {
+		return reply, errors.New("socks5: " + socks5CmdNames[cmd] + " " + socks5ReplyNames[reply.Rep])
+	}
+	return reply, nil
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Judge canary replies with it, so reaching the canary through the proxy is told apart from any other reply.
+const SSRFCanaryMarker = "proxychick-canary"
+
+// Outcome of the attempt to reach the private destination.
+const (
+	SSRFBlocked = "blocked" // proxy refused or couldn't reach the destination
+	SSRFOpen    = "open"    // proxy reached the destination, but it isn't the canary
+	SSRFCanary  = "canary"  // canary replied through the proxy
+)
+
+// Loopback, RFC1918, link-local and cloud metadata destinations the proxies we operate must not reach.
+var DefaultSSRFTargets = []string{
+	"http://127.0.0.1/",
+	"http://localhost/",
+	"http://[::1]/",
+	"http://10.0.0.1/",
+	"http://172.16.0.1/",
+	"http://192.168.0.1/",
+	"http://169.254.169.254/latest/meta-data/",
+	"http://[fd00:ec2::254]/latest/meta-data/",
+	"http://metadata.google.internal/computeMetadata/v1/",
+}
+
+// Settings of the internal network reachability audit.
+type SSRFAuditOpts struct {
+	ProxyTLS *tls.Config // proxy leg of TLSCfg
+}
+
+type SSRFStats struct {
+	Tunnel  string `csv:"tunnel" json:"tunnel"`   // one of SSRF* for CONNECT or SOCKS tunnel
+	Forward string `csv:"forward" json:"forward"` // one of SSRF* for absolute-URI request, empty for SOCKS proxies
+}
+
+// Proxy replied to the tunnel or forward request, rejected credentials don't count.
+func proxyAnswered(res *Result) bool {
+	if res.ProxyStatusCode == http.StatusProxyAuthRequired || res.TargetStatusCode == http.StatusProxyAuthRequired {
+		// forward request gets the proxy reply as the target one
+		return false
+	}
+	return res.Status || res.ProxyStatusCode != 0 || res.ProxySOCKSReply != ""
+}
+
+// Tunnel is open once the proxy granted it, even if the destination doesn't speak HTTP.
+func ssrfTunnelOutcome(res *Result) string {
+	granted := res.ProxyStatusCode == http.StatusOK || strings.HasPrefix(res.ProxySOCKSReply, "0 ") || strings.HasPrefix(res.ProxySOCKSReply, "90 ")
+	switch {
+	case strings.Contains(res.RespPayload, SSRFCanaryMarker):
+		return SSRFCanary
+	case res.Status || granted:
+		return SSRFOpen
+	}
+	return SSRFBlocked
+}
+
+// Proxy reports its own failures with 4xx/5xx, so only the other replies are counted as reached destination.
+func ssrfForwardOutcome(res *Result) string {
+	switch {
+	case strings.Contains(res.RespPayload, SSRFCanaryMarker):
+		return SSRFCanary
+	case res.Status && res.TargetStatusCode < http.StatusBadRequest:
+		return SSRFOpen
+	}
+	return SSRFBlocked
+}
+
+// Tries to reach the private destination through the proxy with a tunnel(CONNECT or SOCKS) and, for HTTP(S) proxies, with absolute-URI request.
+// Result is successful if the proxy answered and valid if both attempts were blocked.
+// Latency and proxy reply are the ones of the tunnel attempt.
+func TestSSRF(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, opts *SSRFAuditOpts) (res *Result, err error) {
+	res, err = TestHTTP(targetURL, proxyURL, timeOut, true, &HTTPTestOpts{ProxyTLS: opts.ProxyTLS, ProxyMode: ProxyModeConnect})
+	res.SSRF.Tunnel = ssrfTunnelOutcome(res)
+	answered := proxyAnswered(res)
+	if !IsSOCKS(proxyURL) {
+		fwdRes, _ := TestHTTP(targetURL, proxyURL, timeOut, true, &HTTPTestOpts{ProxyTLS: opts.ProxyTLS, ProxyMode: ProxyModeForward})
+		res.SSRF.Forward = ssrfForwardOutcome(fwdRes)
+		res.Traffic = res.Traffic.Add(fwdRes.Traffic)
+		answered = answered || proxyAnswered(fwdRes)
+	}
+	res.RespPayload = ""
+	res.Status = answered
+	if answered {
+		// the destination errors are the expected outcome
+		err = nil
+	}
+	res.Valid = answered && res.SSRF.Tunnel == SSRFBlocked && (res.SSRF.Forward == "" || res.SSRF.Forward == SSRFBlocked)
+	return
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Validation error category of the TCP reply that didn't match the expected regex.
+const ValidationBanner = "banner"
+
+// Reply bytes read at most while waiting for the expected banner.
+const tcpReplyLimit = 4096
+
+// What the raw TCP probe sends and expects, e.g. "PING\r\n" and "^\+PONG" for Redis.
+type TCPProbeCfg struct {
+	Payload string `yaml:"payload" json:"payload"` // sent right after the tunnel is established
+	Expect  string `yaml:"expect" json:"expect"`   // regex the reply has to match, e.g. "^220 " for SMTP or "^SSH-2.0-"
+}
+
+// Values of other set over the ones of c.
+func (c TCPProbeCfg) Merge(other TCPProbeCfg) TCPProbeCfg {
+	if other.Payload != "" {
+		c.Payload = other.Payload
+	}
+	if other.Expect != "" {
+		c.Expect = other.Expect
+	}
+	return c
+}
+
+// Settings of the raw TCP checker.
+type TCPTestOpts struct {
+	Payload  string
+	Expect   *regexp.Regexp
+	ProxyTLS *tls.Config // proxy leg of TLSCfg
+}
+
+func NewTCPTestOpts(cfg TCPProbeCfg, proxyTLS *tls.Config) (*TCPTestOpts, error) {
+	rv := &TCPTestOpts{Payload: cfg.Payload, ProxyTLS: proxyTLS}
+	if cfg.Expect != "" {
+		expect, err := regexp.Compile(cfg.Expect)
+		if err != nil {
+			return nil, errors.New("tcp: Can't compile expect regex: " + err.Error())
+		}
+		rv.Expect = expect
+	}
+	return rv, nil
+}
+
+// Tunnels through the proxy to tcp://host:port target, sends the payload and reads the reply if there is payload or expected banner.
+// Without both it only checks the tunnel can be established.
+func TestTCP(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, includeRespPayload bool, opts *TCPTestOpts) (res *Result, err error) {
+	if opts == nil {
+		opts = &TCPTestOpts{}
+	}
+	res = &Result{}
+	res.Ts = time.Now()
+	res.ProxyURL = URL{*proxyURL}
+	res.TargetURL = URL{*targetURL}
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
+
+	if targetURL.Port() == "" {
+		err = errors.New("tcp: Target port is required, e.g. tcp://host:25")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	conn, err := dialTunnel(ctx, proxyURL, targetURL.Host, opts.ProxyTLS, traffic, res)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if opts.Payload != "" {
+		if _, err = conn.Write([]byte(opts.Payload)); err != nil {
+			err = errors.New("tcp: Failed to send payload: " + err.Error())
+			return
+		}
+	}
+	if opts.Payload != "" || opts.Expect != nil {
+		reply := make([]byte, 0, tcpReplyLimit)
+		buf := make([]byte, tcpReplyLimit)
+		for len(reply) < tcpReplyLimit {
+			n, readErr := conn.Read(buf[:tcpReplyLimit-len(reply)])
+			if n > 0 && len(reply) == 0 {
+				res.Latency.TTFB = int(time.Since(res.Ts).Milliseconds())
+			}
+			reply = append(reply, buf[:n]...)
+			if readErr != nil || opts.Expect == nil || opts.Expect.Match(reply) {
+				// without the expected banner any reply will do
+				break
+			}
+		}
+		if len(reply) == 0 {
+			err = errors.New("tcp: No reply from the target")
+			return
+		}
+		res.Banner, _, _ = strings.Cut(string(reply), "\n")
+		res.Banner = strings.TrimSpace(res.Banner)
+		if includeRespPayload {
+			res.RespPayload = string(reply)
+		}
+		if opts.Expect != nil {
+			res.ValidationErrors = StrList{}
+			if !opts.Expect.Match(reply) {
+				res.ValidationErrors = append(res.ValidationErrors, ValidationBanner)
+			}
+		}
+	}
+	res.Status = true
+	res.Valid = len(res.ValidationErrors) == 0
+	return
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Budgets of the HTTP checker, each of them is reported as the timeout category once exceeded.
+const (
+	TimeoutConnect   = "connect"   // TCP connection and TLS handshake to the proxy
+	TimeoutProxyResp = "proxyResp" // CONNECT or SOCKS reply of the proxy
+	TimeoutTLS       = "tls"       // TLS handshake with the target through the proxy
+	TimeoutTTFB      = "ttfb"      // first byte of the reply since the request start
+	TimeoutTotal     = "total"     // whole request including the body and redirects
+	TimeoutWarm      = "warm"      // each keep-alive request after the first one, gets the total budget
+)
+
+// Per-phase budgets of the HTTP checker, zero ones are the same as the checker timeout.
+type HTTPTimeouts struct {
+	Connect   time.Duration
+	ProxyResp time.Duration
+	TLS       time.Duration
+	TTFB      time.Duration
+	Total     time.Duration
+}
+
+// Budgets with the zero ones replaced by timeOut, nil means all of them are timeOut.
+func (t *HTTPTimeouts) resolve(timeOut time.Duration) HTTPTimeouts {
+	rv := HTTPTimeouts{}
+	if t != nil {
+		rv = *t
+	}
+	for _, budget := range []*time.Duration{&rv.Connect, &rv.ProxyResp, &rv.TLS, &rv.TTFB, &rv.Total} {
+		if *budget <= 0 {
+			*budget = timeOut
+		}
+	}
+	return rv
+}
+
+// Cause of the context cancelled by the exceeded budget.
+type budgetExceeded struct {
+	budget string
+}
+
+func (e *budgetExceeded) Error() string {
+	return "timeout: " + e.budget + " budget exceeded"
+}
+
+// Context of the phase, it's cancelled with the budget as the cause once limit passes.
+func withBudget(ctx context.Context, budget string, limit time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, limit, &budgetExceeded{budget})
+}
+
+// Replaces err with the exceeded budget if err carries it or ctx was cancelled by it.
+func budgetErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		// conn deadlines fire along with ctx, so the cause may be not set yet
+		<-ctx.Done()
+	}
+	var exceeded *budgetExceeded
+	if errors.As(err, &exceeded) || errors.As(context.Cause(ctx), &exceeded) {
+		return exceeded
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+// TLS settings for one leg of the connection: client to proxy or client to target.
+// Proxy leg(ProxyTLS of the checker options) is used only for https:// proxies, SNI defaults to the proxy host.
+type TLSCfg struct {
+	CAFile   string `json:"CAFile"`
+	Insecure bool   `json:"Insecure"`
+	SNI      string `json:"SNI"`
+	CertFile string `json:"CertFile"`
+	KeyFile  string `json:"KeyFile"`
+}
+
+// Build crypto/tls config. CA bundle is appended to the system pool, client certificate is used for mTLS.
+func (c TLSCfg) NewTLSConfig() (*tls.Config, error) {
+	rv := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+		ServerName:         c.SNI,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.New("tls: Can't read CA bundle " + c.CAFile + ": " + err.Error())
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("tls: No PEM certificates found in " + c.CAFile)
+		}
+		rv.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.New("tls: Can't load client certificate: " + err.Error())
+		}
+		rv.Certificates = []tls.Certificate{cert}
+	}
+	return rv, nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// Bytes sent to and received from the proxy on the wire, TLS and proxy handshakes included.
+type Traffic struct {
+	Sent     int64 `csv:"sent" json:"sent"`
+	Received int64 `csv:"received" json:"received"`
+}
+
+func (t Traffic) Total() int64 {
+	return t.Sent + t.Received
+}
+
+func (t Traffic) Add(other Traffic) Traffic {
+	return Traffic{t.Sent + other.Sent, t.Received + other.Received}
+}
+
+// Traffic counter shared by all connections of one test, safe for concurrent use.
+type trafficCounter struct {
+	sent, received atomic.Int64
+}
+
+func (c *trafficCounter) traffic() Traffic {
+	return Traffic{c.sent.Load(), c.received.Load()}
+}
+
+// Counts bytes passed through conn, overhead is added for each non empty Read and Write(e.g. datagram header).
+func (c *trafficCounter) wrap(conn net.Conn, overhead int64) net.Conn {
+	return &countingConn{conn, c, overhead}
+}
+
+type countingConn struct {
+	net.Conn
+	counter  *trafficCounter
+	overhead int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.counter.received.Add(int64(n) + c.overhead)
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.counter.sent.Add(int64(n) + c.overhead)
+	}
+	return n, err
+}
+
+// Size of SOCKS5 UDP request header for the target address.
+func socks5UDPHeaderLen(targetAddr string) int64 {
+	host, _, _ := net.SplitHostPort(targetAddr)
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			return 10
+		}
+		return 22
+	}
+	return 7 + int64(len(host))
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// How the tunnel was closed, empty if it lived the whole test duration.
+const (
+	TunnelDropEOF       = "eof"       // closed gracefully(FIN) by the proxy or the target
+	TunnelDropReset     = "reset"     // connection reset
+	TunnelDropTimeout   = "timeout"   // heartbeat wasn't echoed on time
+	TunnelDropCorrupted = "corrupted" // echoed heartbeat differs from the sent one
+	TunnelDropError     = "error"
+)
+
+// Settings of the tunnel stability checker.
+type TunnelTestOpts struct {
+	Duration  time.Duration // how long the tunnel is kept open
+	Interval  time.Duration // btw heartbeats
+	ProxyTLS  *tls.Config   // proxy leg of TLSCfg
+	Heartbeat string        // message prefix, it is suffixed with the sequence number and new line
+}
+
+type TunnelStats struct {
+	Lifetime   int     `csv:"lifetime" json:"lifetime"`     // ms btw tunnel establishment and its drop or the end of the test
+	Drop       string  `csv:"drop" json:"drop"`             // one of TunnelDrop*, empty if the tunnel survived
+	Heartbeats IntList `csv:"heartbeats" json:"heartbeats"` // RTT of each echoed heartbeat(ms)
+}
+
+// Opens TCP tunnel to targetAddr(host:port) through the proxy: CONNECT for http(s) proxies and SOCKS handshake for socks ones.
+// Proxy TLS and handshake latencies, proxy reply and traffic are recorded into res.
+func dialTunnel(ctx context.Context, proxyURL *url.URL, targetAddr string, proxyTLS *tls.Config, traffic *trafficCounter, res *Result) (net.Conn, error) {
+	started := time.Now()
+	conn, err := (&net.Dialer{KeepAlive: -1}).DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, errors.New("c2p transport: " + err.Error())
+	}
+	res.Latency.Connect = int(time.Since(started).Milliseconds())
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		res.ProxyServIPAddr = addr.IP
+	}
+	conn = traffic.wrap(conn, 0)
+	if proxyURL.Scheme == "https" {
+		if proxyTLS != nil {
+			proxyTLS = proxyTLS.Clone()
+		} else {
+			proxyTLS = &tls.Config{}
+		}
+		if proxyTLS.ServerName == "" {
+			proxyTLS.ServerName = proxyURL.Hostname()
+		}
+		tlsConn := tls.Client(conn, proxyTLS)
+		proxyTLSStarted := time.Now()
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, errors.New("c2p tls: " + err.Error())
+		}
+		res.Latency.ProxyTLSHandshake = int(time.Since(proxyTLSStarted).Milliseconds())
+		conn = tlsConn
+	}
+	if IsSOCKS(proxyURL) {
+		socksTrace := SOCKSTrace{}
+		err = SOCKSHandshake(ctx, conn, proxyURL, targetAddr, &socksTrace)
+		res.Latency.SOCKSGreeting = int(socksTrace.Greeting.Milliseconds())
+		res.Latency.SOCKSAuth = int(socksTrace.Auth.Milliseconds())
+		res.ProxySOCKSReply = socksTrace.Reply
+	} else {
+		res.ProxyMode = ProxyModeConnect
+		connectRes, connectErr := HTTPConnect(ctx, conn, proxyURL, targetAddr)
+		if connectRes != nil {
+			res.ProxyStatusCode = connectRes.StatusCode
+			res.ProxyRespHeader = connectRes.Header
+		}
+		err = connectErr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Latency.ProxyResp = int(time.Since(started).Milliseconds())
+	return conn, nil
+}
+
+// Category of the error tunnel was dropped with.
+func tunnelDropReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return TunnelDropEOF
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return TunnelDropReset
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return TunnelDropTimeout
+	}
+	return TunnelDropError
+}
+
+// Keeps a tunnel through the proxy to the echo target open for opts.Duration, sending heartbeats every opts.Interval.
+// Result is successful if the tunnel was established and valid if it survived the whole duration.
+// Between heartbeats the tunnel is read, so its drop is noticed right away.
+func TestTunnel(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, opts *TunnelTestOpts) (res *Result, err error) {
+	res = &Result{}
+	res.Ts = time.Now()
+	res.ProxyURL = URL{*proxyURL}
+	res.TargetURL = URL{*targetURL}
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	conn, err := dialTunnel(ctx, proxyURL, targetHostPort(targetURL), opts.ProxyTLS, traffic, res)
+	cancel()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	res.Status = true
+	res.Tunnel.Heartbeats = IntList{}
+	established := time.Now()
+	defer func() {
+		res.Tunnel.Lifetime = int(time.Since(established).Milliseconds())
+		res.Valid = res.Tunnel.Drop == ""
+	}()
+	heartbeat := opts.Heartbeat
+	if heartbeat == "" {
+		heartbeat = "proxychick heartbeat"
+	}
+	idle := make([]byte, 1)
+	for seq := 1; ; seq++ {
+		sent := time.Now()
+		msg := []byte(heartbeat + " " + strconv.Itoa(seq) + "\n")
+		echo := make([]byte, len(msg))
+		conn.SetDeadline(sent.Add(timeOut))
+		if _, err = conn.Write(msg); err == nil {
+			_, err = io.ReadFull(conn, echo)
+		}
+		if err != nil {
+			res.Tunnel.Drop = tunnelDropReason(err)
+			err = errors.New("tunnel: Dropped after " + strconv.Itoa(seq-1) + " heartbeats: " + err.Error())
+			return
+		}
+		if !bytes.Equal(msg, echo) {
+			res.Tunnel.Drop = TunnelDropCorrupted
+			err = errors.New("tunnel: Heartbeat " + strconv.Itoa(seq) + " echo mismatch")
+			return
+		}
+		res.Tunnel.Heartbeats = append(res.Tunnel.Heartbeats, int(time.Since(sent).Milliseconds()))
+		if seq == 1 {
+			res.Latency.TTFB = int(time.Since(res.Ts).Milliseconds())
+		}
+		next := sent.Add(opts.Interval)
+		if end := established.Add(opts.Duration); next.After(end) {
+			next = end
+		}
+		// nothing is expected from the echo target until the next heartbeat, only the drop
+		conn.SetReadDeadline(next)
+		if _, err = conn.Read(idle); err == nil {
+			res.Tunnel.Drop = TunnelDropCorrupted
+			err = errors.New("tunnel: Unexpected data from the target")
+			return
+		} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			res.Tunnel.Drop = tunnelDropReason(err)
+			err = errors.New("tunnel: Dropped after " + strconv.Itoa(seq) + " heartbeats: " + err.Error())
+			return
+		}
+		err = nil
+		if !time.Now().Before(established.Add(opts.Duration)) {
+			return
+		}
+	}
+}
@@ -1,47 +1,192 @@
 package client
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/greggyNapalm/gost"
+	"github.com/go-gost/gosocks5"
 	"net"
 	"net/url"
+	"strconv"
 	"time"
 )
 
-func TestUDPEcho(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, includeRespPayload bool, debug bool) (res *Result, err error) {
+// Phases of the SOCKS5 UDP association, each of them gets its own timeout.
+const (
+	UDPPhaseDial      = "dial"      // TCP connection to the proxy
+	UDPPhaseHandshake = "handshake" // SOCKS5 greeting and auth
+	UDPPhaseAssociate = "associate" // UDP ASSOCIATE request and the relay socket
+	UDPPhaseRead      = "read"      // reply of the target
+)
+
+// Error categories of the phases that ran out of time.
+var udpPhaseTimeouts = map[string]string{
+	UDPPhaseDial:      "c2p transport: Dial timeout",
+	UDPPhaseHandshake: "c2p socks5: Handshake timeout",
+	UDPPhaseAssociate: "c2p socks5: UDP ASSOCIATE timeout",
+	UDPPhaseRead:      "c2t transport: Read timeout",
+}
+
+// Replaces err with the timeout category of the phase if the phase ran out of time, SOCKS errors don't wrap the net ones.
+func udpPhaseErr(ctx context.Context, phase string, err error) error {
+	var netErr net.Error
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return errors.New(udpPhaseTimeouts[phase])
+	}
+	return err
+}
+
+// Datagrams sent to and received from the SOCKS5 UDP relay carry the header with the target address(RFC 1928, section 7).
+type socks5UDPConn struct {
+	net.Conn
+	target *gosocks5.Addr
+	buf    []byte
+}
+
+func (c *socks5UDPConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(c.buf)
+	if err != nil {
+		return 0, err
+	}
+	// RSV(2), FRAG(1), ATYP(1) followed by the address and port
+	hlen := 0
+	if n > 4 {
+		switch c.buf[3] {
+		case gosocks5.AddrIPv4:
+			hlen = 10
+		case gosocks5.AddrIPv6:
+			hlen = 22
+		case gosocks5.AddrDomain:
+			hlen = 7 + int(c.buf[4])
+		}
+	}
+	if hlen == 0 || n < hlen {
+		return 0, errors.New("socks5: Malformed UDP datagram from the relay")
+	}
+	return copy(b, c.buf[hlen:n]), nil
+}
+
+func (c *socks5UDPConn) Write(b []byte) (int, error) {
+	if err := gosocks5.NewUDPDatagram(gosocks5.NewUDPHeader(0, 0, c.target), b).Write(c.Conn); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Establishes SOCKS5 UDP association through the proxy to targetURL(host:port), proxy latency and address are recorded into res.
+// Dial, handshake and associate phases get timeOut each within ctx. Both the control TCP connection and the UDP one are counted by traffic, the caller closes them.
+func dialUDP(ctx context.Context, targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, traffic *trafficCounter, res *Result) (ctrlConn net.Conn, udpConn net.Conn, err error) {
+	started := time.Now()
+	phaseCtx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	conn, err := (&net.Dialer{KeepAlive: -1}).DialContext(phaseCtx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, nil, udpPhaseErr(phaseCtx, UDPPhaseDial, errors.New("c2p transport: Failed to establish TCP connetion to Proxy server"))
+	}
+	res.Latency.Connect = int(time.Since(started).Milliseconds())
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		res.ProxyServIPAddr = addr.IP
+	}
+	conn = traffic.wrap(conn, 0)
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	socksTrace := SOCKSTrace{}
+	phaseCtx, cancel = context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	stop := context.AfterFunc(phaseCtx, func() { conn.SetDeadline(time.Now()) })
+	err = socks5Greeting(conn, proxyURL, &socksTrace)
+	stop()
+	res.Latency.SOCKSGreeting = int(socksTrace.Greeting.Milliseconds())
+	res.Latency.SOCKSAuth = int(socksTrace.Auth.Milliseconds())
+	if err != nil {
+		return nil, nil, udpPhaseErr(phaseCtx, UDPPhaseHandshake, err)
+	}
+
+	phaseCtx, cancel = context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	stop = context.AfterFunc(phaseCtx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	targetAddr, err := socksTargetAddr(phaseCtx, "socks5", targetURL.Host)
+	if err != nil {
+		return nil, nil, udpPhaseErr(phaseCtx, UDPPhaseAssociate, errors.New("c2t transport: Failed to resolve "+targetURL.Hostname()))
+	}
+	target, err := gosocks5.NewAddr(targetAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// client address isn't known before the relay socket is opened, so it's left unspecified
+	reply, err := socks5Request(conn, gosocks5.CmdUdp, &gosocks5.Addr{Type: gosocks5.AddrIPv4}, &socksTrace)
+	res.ProxySOCKSReply = socksTrace.Reply
+	if err != nil {
+		return nil, nil, udpPhaseErr(phaseCtx, UDPPhaseAssociate, err)
+	}
+	relayHost := reply.Addr.Host
+	if ip := net.ParseIP(relayHost); ip == nil || ip.IsUnspecified() {
+		// relay on all interfaces is reached at the proxy address
+		relayHost = res.ProxyServIPAddr.String()
+	}
+	relayConn, err := (&net.Dialer{}).DialContext(phaseCtx, "udp", net.JoinHostPort(relayHost, strconv.Itoa(int(reply.Addr.Port))))
+	if err != nil {
+		return nil, nil, udpPhaseErr(phaseCtx, UDPPhaseAssociate, errors.New("c2t transport: Failed to establish UDP connection"))
+	}
+	stop()
+	conn.SetDeadline(time.Time{})
+	res.Latency.ProxyResp = int(time.Since(started).Milliseconds())
+	udpConn = &socks5UDPConn{Conn: relayConn, target: target, buf: make([]byte, 64<<10)}
+	// datagrams are counted with their SOCKS5 UDP header
+	return conn, traffic.wrap(udpConn, socks5UDPHeaderLen(targetAddr)), nil
+}
+
+// Earlier of t and ctx deadline, so the conn deadline set later doesn't outlive ctx.
+func ctxDeadline(ctx context.Context, t time.Time) time.Time {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(t) {
+		return deadline
+	}
+	return t
+}
+
+// Reads the reply of the target within timeOut, ctx cancellation interrupts the read.
+func readUDP(ctx context.Context, conn net.Conn, buf []byte, timeOut time.Duration) (int, error) {
+	readCtx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	stop := context.AfterFunc(readCtx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	n, err := conn.Read(buf)
+	if err != nil {
+		return n, udpPhaseErr(readCtx, UDPPhaseRead, errors.New("c2t transport: Failed to read from UDP socket"))
+	}
+	return n, nil
+}
+
+// Sends the greeting datagram through SOCKS5 UDP association to the echo target and awaits the reply.
+// Every phase(dial, handshake, associate and read) gets timeOut within ctx, so ctx deadline bounds the whole test.
+// The phase that ran out of time is the error category.
+func TestUDPEcho(ctx context.Context, targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, includeRespPayload bool, debug bool) (res *Result, err error) {
 	res = &Result{}
 	res.Ts = time.Now()
-	err = errors.New("proxycheck: Failed to establish TCP connetion to Proxy server")
 	res.ProxyURL = URL{*proxyURL}
-	res.TargetURL = *targetURL
+	res.TargetURL = URL{*targetURL}
 	res.Status = false
-	client := &gost.Client{
-		Connector:   gost.SOCKS5UDPConnector(proxyURL.User),
-		Transporter: gost.TCPTransporter(),
-	}
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
 	AllStarted := time.Now()
-	conn, err := client.Dial(proxyURL.Host, gost.TimeoutDialOption(time.Duration(timeOut)*time.Second))
+	conn, udpConn, err := dialUDP(ctx, targetURL, proxyURL, timeOut, traffic, res)
 	if err != nil {
-		return res, errors.New("c2p transport: Failed to establish TCP connetion to Proxy server")
+		return
 	}
-	res.Latency.ProxyResp = int(time.Since(AllStarted).Milliseconds())
-	addr, _ := net.ResolveTCPAddr("tcp", conn.RemoteAddr().String())
-	res.ProxyServIPAddr = addr.IP
 	defer conn.Close()
-
-	udpConn, err := client.Connect(conn, targetURL.Host, gost.TimeoutConnectOption(timeOut))
-	if err != nil {
-		return res, errors.New("c2t transport: Failed to establish UDP connection")
-	}
-	udpConn.SetDeadline(time.Now().Add(timeOut))
 	defer udpConn.Close()
-	udpConn.Write([]byte("Hello from ProxyChick"))
-	resp := make([]byte, 1024)
-	n, err := bufio.NewReader(udpConn).Read(resp)
+	if _, err = udpConn.Write([]byte("Hello from ProxyChick")); err != nil {
+		return res, errors.New("c2t transport: Failed to write to UDP socket")
+	}
+	resp := make([]byte, UDPMaxDatagram)
+	n, err := readUDP(ctx, udpConn, resp, timeOut)
 	if err != nil {
-		return res, errors.New("c2t transport: Failed to read from UDP socket")
+		return
 	}
 	// It's TimeToLastByte, but they fits in one datagram, so it good enough for the test.
 	res.Latency.TTFB = int(time.Since(AllStarted).Milliseconds())
@@ -49,7 +194,7 @@ func TestUDPEcho(targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, i
 		res.RespPayload = string(resp[:n])
 	}
 	if debug {
-		fmt.Println("Connection to proxy: TCP", udpConn.RemoteAddr(), "Connection to target: UDP", targetURL.Host, "reply:", res.RespPayload)
+		fmt.Println("Connection to proxy: TCP", conn.RemoteAddr(), "Connection to target: UDP", targetURL.Host, "reply:", res.RespPayload)
 	}
 	res.Status = true
 	return
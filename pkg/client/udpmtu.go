@@ -0,0 +1,137 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Largest UDP payload over IPv4 less the largest SOCKS5 UDP header.
+const UDPMaxDatagram = 65507 - 262
+
+// Smallest datagram of the MTU probe, proxy that doesn't relay it doesn't relay UDP at all.
+const UDPMTUMinSize = 64
+
+// Each size is sent up to that many times, so the single lost datagram isn't taken for the size limit.
+const udpMTUTries = 2
+
+// UDP datagram size probe of the UDP checker: binary search of the largest payload echoed intact.
+type UDPMTUCfg struct {
+	Max          int           // largest payload bytes to try, UDPMaxDatagram at most
+	ProbeTimeout time.Duration // echo await of each size after the smallest one, 0 means timeOut
+}
+
+// Echo await of the sizes searched after the smallest one.
+func (cfg *UDPMTUCfg) probeTimeout(timeOut time.Duration) time.Duration {
+	if cfg.ProbeTimeout > 0 {
+		return cfg.ProbeTimeout
+	}
+	return timeOut
+}
+
+// Time the test may take: timeOut for the association and the smallest size, probe timeout for each of the other probes the search can send.
+func (cfg *UDPMTUCfg) Budget(timeOut time.Duration) time.Duration {
+	probes := udpMTUTries * (1 + bits.Len(uint(max(cfg.Max-UDPMTUMinSize, 1))))
+	return timeOut*(1+udpMTUTries) + cfg.probeTimeout(timeOut)*time.Duration(probes)
+}
+
+type UDPMTUStats struct {
+	MaxSize int `csv:"maxSize" json:"maxSize"` // largest payload bytes the proxy relayed intact both ways
+	Probes  int `csv:"probes" json:"probes"`   // datagrams sent during the search
+}
+
+// Sends the datagram of size bytes(sequence number followed by random bytes) and awaits its echo till deadline.
+// Echoes of the former probes are skipped, truncated or altered echo fails the size at once.
+func udpMTUProbe(conn net.Conn, seq uint32, size int, deadline time.Time, buf []byte) (bool, error) {
+	datagram := make([]byte, size)
+	binary.BigEndian.PutUint32(datagram, seq)
+	rand.Read(datagram[4:])
+	if _, err := conn.Write(datagram); err != nil {
+		return false, errors.New("c2t transport: Failed to send " + strconv.Itoa(size) + " bytes datagram: " + err.Error())
+	}
+	conn.SetReadDeadline(deadline)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			// dropped
+			return false, nil
+		}
+		if n < 4 || binary.BigEndian.Uint32(buf) != seq {
+			continue
+		}
+		return bytes.Equal(buf[:n], datagram), nil
+	}
+}
+
+// Binary-searches the largest payload btw UDPMTUMinSize and cfg.Max the proxy relays to the echo target and back intact.
+// The smallest size is awaited for timeOut, the others for cfg probe timeout, ctx cancellation fails the probe in flight. Result is successful if the smallest datagram was echoed.
+func TestUDPMTU(ctx context.Context, targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, cfg *UDPMTUCfg) (res *Result, err error) {
+	res = &Result{}
+	res.Ts = time.Now()
+	res.ProxyURL = URL{*proxyURL}
+	res.TargetURL = URL{*targetURL}
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
+	conn, udpConn, err := dialUDP(ctx, targetURL, proxyURL, timeOut, traffic, res)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer udpConn.Close()
+	stop := context.AfterFunc(ctx, func() { udpConn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	// larger buffer tells the truncated echo apart from the one of the greater datagram
+	buf := make([]byte, UDPMaxDatagram+1)
+	relays := func(size int, await time.Duration) (bool, error) {
+		for try := 0; try < udpMTUTries; try++ {
+			res.UDPMTU.Probes++
+			ok, err := udpMTUProbe(udpConn, uint32(res.UDPMTU.Probes), size, ctxDeadline(ctx, time.Now().Add(await)), buf)
+			if ok || err != nil {
+				return ok, err
+			}
+			if ctx.Err() != nil {
+				return false, udpPhaseErr(ctx, UDPPhaseRead, ctx.Err())
+			}
+		}
+		return false, nil
+	}
+	lo, hi := UDPMTUMinSize, min(max(cfg.Max, UDPMTUMinSize), UDPMaxDatagram)
+	ok, err := relays(lo, timeOut)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return res, errors.New("c2t transport: No datagrams echoed")
+	}
+	res.Latency.TTFB = int(time.Since(res.Ts).Milliseconds())
+	probeTimeout := cfg.probeTimeout(timeOut)
+	if ok, err = relays(hi, probeTimeout); err != nil {
+		return
+	}
+	if ok {
+		lo = hi
+	}
+	// lo is relayed and hi isn't
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if ok, err = relays(mid, probeTimeout); err != nil {
+			return
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	res.UDPMTU.MaxSize = lo
+	res.Status = true
+	return
+}
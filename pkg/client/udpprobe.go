@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Probe types of the UDP checker, echo is the datascrape JSON echo.
+const (
+	UDPProbeEcho = "echo"
+	UDPProbeDNS  = "dns"
+	UDPProbeSTUN = "stun"
+	UDPProbeNTP  = "ntp"
+)
+
+var UDPProbes = []string{UDPProbeEcho, UDPProbeDNS, UDPProbeSTUN, UDPProbeNTP}
+
+// Public servers the probes are sent to when no target is given.
+var DefaultUDPProbeTargets = map[string]string{
+	UDPProbeDNS:  "udp://1.1.1.1:53",
+	UDPProbeSTUN: "udp://stun.l.google.com:19302",
+	UDPProbeNTP:  "udp://pool.ntp.org:123",
+}
+
+// Settings of the real-protocol UDP probe.
+type UDPProbeCfg struct {
+	Type    string // one of UDPProbes except echo
+	DNSName string // name the DNS probe asks A records of
+}
+
+type UDPProbeStats struct {
+	Type string `csv:"type" json:"type"`
+	// DNS A records space separated, STUN mapped address(exit IP:port) or NTP server time in RFC 3339
+	Answer      string `csv:"answer" json:"answer"`
+	ClockOffset int    `csv:"clockOffset" json:"clockOffset"` // local clock offset from the NTP server(ms)
+}
+
+const (
+	stunMagicCookie      = 0x2112A442
+	stunBindingRequest   = 0x0001
+	stunBindingResponse  = 0x0101
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+	ntpEpochOffset       = 2208988800 // seconds btw 1900 and 1970
+)
+
+func newDNSQuery(name string) ([]byte, uint16, error) {
+	var id [2]byte
+	rand.Read(id[:])
+	qName, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, 0, errors.New("dns: Bad query name " + name)
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qName, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	query, err := msg.Pack()
+	return query, msg.Header.ID, err
+}
+
+// A records of the reply to the query with id.
+func parseDNSReply(reply []byte, id uint16) ([]string, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		return nil, errors.New("dns: Malformed reply")
+	}
+	if msg.Header.ID != id {
+		return nil, errors.New("dns: Reply ID mismatch")
+	}
+	if msg.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, errors.New("dns: Server replied " + strings.TrimPrefix(msg.Header.RCode.String(), "RCode"))
+	}
+	rv := []string{}
+	for _, answer := range msg.Answers {
+		if a, ok := answer.Body.(*dnsmessage.AResource); ok {
+			rv = append(rv, net.IP(a.A[:]).String())
+		}
+	}
+	if len(rv) == 0 {
+		return nil, errors.New("dns: No A records in the reply")
+	}
+	return rv, nil
+}
+
+func newSTUNBindingRequest() (request []byte, txID []byte) {
+	request = make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	rand.Read(request[8:20])
+	return request, request[8:20]
+}
+
+// Mapped address of the Binding response, XOR-MAPPED-ADDRESS is preferred over MAPPED-ADDRESS.
+func parseSTUNResponse(reply []byte, txID []byte) (*net.UDPAddr, error) {
+	if len(reply) < 20 || binary.BigEndian.Uint16(reply[0:]) != stunBindingResponse || binary.BigEndian.Uint32(reply[4:]) != stunMagicCookie {
+		return nil, errors.New("stun: Not a Binding success response")
+	}
+	if string(reply[8:20]) != string(txID) {
+		return nil, errors.New("stun: Transaction ID mismatch")
+	}
+	var mapped *net.UDPAddr
+	attrs := reply[20:min(len(reply), 20+int(binary.BigEndian.Uint16(reply[2:])))]
+	for len(attrs) >= 4 {
+		attrType, attrLen := binary.BigEndian.Uint16(attrs[0:]), int(binary.BigEndian.Uint16(attrs[2:]))
+		if len(attrs) < 4+attrLen {
+			break
+		}
+		val := attrs[4 : 4+attrLen]
+		// family 1 is IPv4 and 2 is IPv6
+		if (attrType == stunXORMappedAddress || attrType == stunMappedAddress) && len(val) >= 8 {
+			ipLen := 4
+			if val[1] == 2 {
+				ipLen = 16
+			}
+			if len(val) < 4+ipLen {
+				break
+			}
+			addr := &net.UDPAddr{Port: int(binary.BigEndian.Uint16(val[2:])), IP: append(net.IP{}, val[4:4+ipLen]...)}
+			if attrType == stunXORMappedAddress {
+				// port is XORed with the cookie high bits, IP with the cookie followed by the transaction ID
+				addr.Port ^= stunMagicCookie >> 16
+				key := append(reply[4:8:8], txID...)
+				for i := range addr.IP {
+					addr.IP[i] ^= key[i]
+				}
+				return addr, nil
+			}
+			mapped = addr
+		}
+		attrs = attrs[4+(attrLen+3)&^3:]
+	}
+	if mapped == nil {
+		return nil, errors.New("stun: No mapped address in the response")
+	}
+	return mapped, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	secs, frac := binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+	return time.Unix(int64(secs)-ntpEpochOffset, int64(frac)*int64(time.Second)>>32)
+}
+
+func newNTPRequest(sent time.Time) []byte {
+	request := make([]byte, 48)
+	request[0] = 4<<3 | 3 // LI 0, version 4, mode client
+	binary.BigEndian.PutUint32(request[40:], uint32(sent.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(request[44:], uint32((int64(sent.Nanosecond())<<32)/int64(time.Second)))
+	return request
+}
+
+// Server transmit time and the local clock offset from it, (T2 - T1 + T3 - T4) / 2.
+func parseNTPReply(reply []byte, sent time.Time, received time.Time) (time.Time, time.Duration, error) {
+	if len(reply) < 48 {
+		return time.Time{}, 0, errors.New("ntp: Short reply")
+	}
+	if mode := reply[0] & 7; mode != 4 {
+		return time.Time{}, 0, errors.New("ntp: Not a server reply, mode " + strconv.Itoa(int(mode)))
+	}
+	if stratum := reply[1]; stratum == 0 || stratum > 15 {
+		return time.Time{}, 0, errors.New("ntp: Unsynchronized server, stratum " + strconv.Itoa(int(stratum)))
+	}
+	serverReceived, serverSent := ntpTime(reply[32:]), ntpTime(reply[40:])
+	return serverSent, (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// Sends the real-protocol probe(DNS query, STUN Binding or NTP request) through SOCKS5 UDP association to the target server and checks the reply.
+// STUN mapped address is the exit node of the proxy, so it fills ProxyNodeIPAddr. Every phase gets timeOut within ctx.
+func TestUDPProbe(ctx context.Context, targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, cfg *UDPProbeCfg) (res *Result, err error) {
+	res = &Result{}
+	res.Ts = time.Now()
+	res.ProxyURL = URL{*proxyURL}
+	res.TargetURL = URL{*targetURL}
+	res.UDPProbe.Type = cfg.Type
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
+	conn, udpConn, err := dialUDP(ctx, targetURL, proxyURL, timeOut, traffic, res)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer udpConn.Close()
+	udpConn.SetWriteDeadline(time.Now().Add(timeOut))
+
+	var request, txID []byte
+	var dnsID uint16
+	switch cfg.Type {
+	case UDPProbeDNS:
+		if request, dnsID, err = newDNSQuery(cfg.DNSName); err != nil {
+			return
+		}
+	case UDPProbeSTUN:
+		request, txID = newSTUNBindingRequest()
+	case UDPProbeNTP:
+		request = newNTPRequest(time.Now())
+	default:
+		err = errors.New("udp: Unsupported probe " + cfg.Type)
+		return
+	}
+	sent := time.Now()
+	if cfg.Type == UDPProbeNTP {
+		// T1 is written into the request, so it's rebuilt right before sending
+		request = newNTPRequest(sent)
+	}
+	if _, err = udpConn.Write(request); err != nil {
+		err = errors.New("c2t transport: Failed to write to UDP socket")
+		return
+	}
+	reply := make([]byte, 1500)
+	n, err := readUDP(ctx, udpConn, reply, timeOut)
+	if err != nil {
+		return
+	}
+	received := time.Now()
+	res.Latency.TTFB = int(time.Since(res.Ts).Milliseconds())
+	reply = reply[:n]
+	switch cfg.Type {
+	case UDPProbeDNS:
+		var records []string
+		if records, err = parseDNSReply(reply, dnsID); err != nil {
+			return
+		}
+		res.UDPProbe.Answer = strings.Join(records, " ")
+	case UDPProbeSTUN:
+		var mapped *net.UDPAddr
+		if mapped, err = parseSTUNResponse(reply, txID); err != nil {
+			return
+		}
+		res.UDPProbe.Answer = mapped.String()
+		res.ProxyNodeIPAddr = mapped.IP
+	case UDPProbeNTP:
+		var serverTime time.Time
+		var offset time.Duration
+		if serverTime, offset, err = parseNTPReply(reply, sent, received); err != nil {
+			return
+		}
+		res.UDPProbe.Answer = serverTime.UTC().Format(time.RFC3339Nano)
+		res.UDPProbe.ClockOffset = int(offset.Milliseconds())
+	}
+	res.Status = true
+	return
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Datagram of the stream starts with its sequence number and send time(ns since the stream start).
+const udpStreamHeaderLen = 12
+
+// UDP quality mode of the UDP checker: stream of sequenced datagrams sent at the fixed rate.
+type UDPStreamCfg struct {
+	Count int // datagrams per test
+	Rate  int // datagrams per second
+	Size  int // payload bytes of each datagram, udpStreamHeaderLen at least
+}
+
+// Time the test may take: timeOut for the association, the stream itself and timeOut awaiting the echoes.
+func (cfg *UDPStreamCfg) Budget(timeOut time.Duration) time.Duration {
+	return 2*timeOut + time.Second/time.Duration(max(cfg.Rate, 1))*time.Duration(cfg.Count)
+}
+
+type UDPStreamStats struct {
+	Sent       int     `csv:"sent" json:"sent"`
+	Received   int     `csv:"received" json:"received"`     // distinct datagrams echoed, duplicates aren't counted
+	Loss       float64 `csv:"loss" json:"loss"`             // percent of sent datagrams that weren't echoed
+	Jitter     float64 `csv:"jitter" json:"jitter"`         // interarrival jitter(RFC 3550) of the echoes(ms)
+	RTTAvg     float64 `csv:"rttAvg" json:"rttAvg"`         // average round trip time of the echoes(ms)
+	Reordered  int     `csv:"reordered" json:"reordered"`   // echoes that came after the one with the greater sequence number
+	Duplicates int     `csv:"duplicates" json:"duplicates"` // echoes of the already received datagrams
+}
+
+// Rounds to microseconds for ms values, the same 3 digits are kept for percents.
+func roundMs(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// Sends cfg.Count datagrams through SOCKS5 UDP association to the echo target at cfg.Rate and matches the echoes by the sequence number.
+// Echoes are awaited for timeOut after the last datagram is sent, ctx cancellation stops the stream. Result is successful if any datagram was echoed.
+func TestUDPStream(ctx context.Context, targetURL *url.URL, proxyURL *url.URL, timeOut time.Duration, cfg *UDPStreamCfg) (res *Result, err error) {
+	res = &Result{}
+	res.Ts = time.Now()
+	res.ProxyURL = URL{*proxyURL}
+	res.TargetURL = URL{*targetURL}
+	traffic := &trafficCounter{}
+	defer func() { res.Traffic = traffic.traffic() }()
+	conn, udpConn, err := dialUDP(ctx, targetURL, proxyURL, timeOut, traffic, res)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer udpConn.Close()
+	stop := context.AfterFunc(ctx, func() { udpConn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	size := max(cfg.Size, udpStreamHeaderLen)
+	interval := time.Second / time.Duration(max(cfg.Rate, 1))
+	started := time.Now()
+	// the reader stops timeOut after the last datagram is sent, the sender moves the deadline once it's done
+	udpConn.SetReadDeadline(ctxDeadline(ctx, started.Add(interval*time.Duration(cfg.Count)+timeOut)))
+	sendErr := make(chan error, 1)
+	go func() {
+		datagram := make([]byte, size)
+		for seq := 0; seq < cfg.Count; seq++ {
+			time.Sleep(time.Until(started.Add(interval * time.Duration(seq))))
+			if ctx.Err() != nil {
+				sendErr <- nil
+				return
+			}
+			binary.BigEndian.PutUint32(datagram, uint32(seq))
+			binary.BigEndian.PutUint64(datagram[4:], uint64(time.Since(started)))
+			if _, err := udpConn.Write(datagram); err != nil {
+				udpConn.SetReadDeadline(time.Now())
+				sendErr <- errors.New("c2t transport: Failed to send datagram " + strconv.Itoa(seq) + ": " + err.Error())
+				return
+			}
+			res.UDP.Sent = seq + 1
+		}
+		udpConn.SetReadDeadline(ctxDeadline(ctx, time.Now().Add(timeOut)))
+		sendErr <- nil
+	}()
+
+	seen := make([]bool, cfg.Count)
+	maxSeq, prevTransit, rttSum := -1, time.Duration(-1), time.Duration(0)
+	buf := make([]byte, size+udpStreamHeaderLen)
+	for res.UDP.Received < cfg.Count {
+		n, readErr := udpConn.Read(buf)
+		if readErr != nil {
+			break
+		}
+		arrival := time.Since(started)
+		if n < udpStreamHeaderLen {
+			continue
+		}
+		seq := int(binary.BigEndian.Uint32(buf))
+		if seq >= cfg.Count {
+			continue
+		}
+		if seen[seq] {
+			res.UDP.Duplicates++
+			continue
+		}
+		seen[seq] = true
+		res.UDP.Received++
+		if seq < maxSeq {
+			res.UDP.Reordered++
+		}
+		maxSeq = max(maxSeq, seq)
+		transit := arrival - time.Duration(binary.BigEndian.Uint64(buf[4:]))
+		rttSum += transit
+		if res.UDP.Received == 1 {
+			res.Latency.TTFB = int(time.Since(res.Ts).Milliseconds())
+		}
+		if prevTransit >= 0 {
+			// J(i) = J(i-1) + (|D(i-1,i)| - J(i-1))/16
+			d := math.Abs(float64(transit-prevTransit)) / float64(time.Millisecond)
+			res.UDP.Jitter += (d - res.UDP.Jitter) / 16
+		}
+		prevTransit = transit
+	}
+	// the sender is done once all echoes are received or the reader timed out after it finished
+	udpConn.SetReadDeadline(time.Now())
+	err = <-sendErr
+	if res.UDP.Sent > 0 {
+		res.UDP.Loss = roundMs(100 * float64(res.UDP.Sent-res.UDP.Received) / float64(res.UDP.Sent))
+	}
+	if res.UDP.Received > 0 {
+		res.UDP.RTTAvg = roundMs(float64(rttSum) / float64(res.UDP.Received) / float64(time.Millisecond))
+	}
+	res.UDP.Jitter = roundMs(res.UDP.Jitter)
+	if err == nil && res.UDP.Received == 0 {
+		err = errors.New("c2t transport: No datagrams echoed")
+	}
+	res.Status = res.UDP.Received > 0
+	return
+}
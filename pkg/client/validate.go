@@ -0,0 +1,151 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Validation error categories, header one is suffixed with the header name, e.g. "header:Content-Type".
+const (
+	ValidationStatus   = "status"
+	ValidationBodySize = "body-size"
+	ValidationBody     = "body-regex"
+	ValidationJSON     = "json-path"
+	ValidationHeader   = "header"
+)
+
+// Assertions the target response has to pass to be considered usable, not only reachable.
+type ValidationCfg struct {
+	StatusCodes []int             `yaml:"statusCodes" json:"statusCodes"`
+	BodyRegex   string            `yaml:"bodyRegex" json:"bodyRegex"`
+	JSONPath    string            `yaml:"jsonPath" json:"jsonPath"` // dot separated, e.g. "data.items.0.ip"
+	JSONValue   string            `yaml:"jsonValue" json:"jsonValue"`
+	MaxBodySize int64             `yaml:"maxBodySize" json:"maxBodySize"` // bytes
+	Headers     map[string]string `yaml:"headers" json:"headers"`         // name to value regex, empty regex checks presence only
+}
+
+func (c ValidationCfg) IsEmpty() bool {
+	return len(c.StatusCodes) == 0 && c.BodyRegex == "" && c.JSONPath == "" && c.MaxBodySize == 0 && len(c.Headers) == 0
+}
+
+// Values of other set over the ones of c.
+func (c ValidationCfg) Merge(other ValidationCfg) ValidationCfg {
+	if len(other.StatusCodes) > 0 {
+		c.StatusCodes = other.StatusCodes
+	}
+	if other.BodyRegex != "" {
+		c.BodyRegex = other.BodyRegex
+	}
+	if other.JSONPath != "" {
+		c.JSONPath, c.JSONValue = other.JSONPath, other.JSONValue
+	}
+	if other.MaxBodySize != 0 {
+		c.MaxBodySize = other.MaxBodySize
+	}
+	if len(other.Headers) > 0 {
+		headers := make(map[string]string)
+		for k, v := range c.Headers {
+			headers[k] = v
+		}
+		for k, v := range other.Headers {
+			headers[k] = v
+		}
+		c.Headers = headers
+	}
+	return c
+}
+
+// Compiled ValidationCfg.
+type Validator struct {
+	cfg       ValidationCfg
+	bodyRegex *regexp.Regexp
+	headers   map[string]*regexp.Regexp
+}
+
+func NewValidator(cfg ValidationCfg) (*Validator, error) {
+	rv := &Validator{cfg: cfg, headers: make(map[string]*regexp.Regexp)}
+	var err error
+	if cfg.BodyRegex != "" {
+		if rv.bodyRegex, err = regexp.Compile(cfg.BodyRegex); err != nil {
+			return nil, errors.New("validation: Can't compile body regex: " + err.Error())
+		}
+	}
+	for name, expr := range cfg.Headers {
+		if expr == "" {
+			rv.headers[name] = nil
+		} else if rv.headers[name], err = regexp.Compile(expr); err != nil {
+			return nil, errors.New("validation: Can't compile " + name + " header regex: " + err.Error())
+		}
+	}
+	return rv, nil
+}
+
+// Size limit the response body should be read with, 0 means no limit.
+func (v *Validator) BodyReadLimit() int64 {
+	if v.cfg.MaxBodySize > 0 {
+		return v.cfg.MaxBodySize + 1
+	}
+	return 0
+}
+
+// Returns the categories of failed assertions, empty list means the response is valid.
+// Body may be the head of the reply only, bodySize is the size of the whole one.
+func (v *Validator) Validate(resp *http.Response, body []byte, bodySize int64) StrList {
+	rv := StrList{}
+	if len(v.cfg.StatusCodes) > 0 && !slices.Contains(v.cfg.StatusCodes, resp.StatusCode) {
+		rv = append(rv, ValidationStatus)
+	}
+	if v.cfg.MaxBodySize > 0 && bodySize > v.cfg.MaxBodySize {
+		rv = append(rv, ValidationBodySize)
+	}
+	if v.bodyRegex != nil && !v.bodyRegex.Match(body) {
+		rv = append(rv, ValidationBody)
+	}
+	if v.cfg.JSONPath != "" && !jsonPathEquals(body, v.cfg.JSONPath, v.cfg.JSONValue) {
+		rv = append(rv, ValidationJSON)
+	}
+	for name, expr := range v.headers {
+		vals, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		if !ok || (expr != nil && !slices.ContainsFunc(vals, expr.MatchString)) {
+			rv = append(rv, ValidationHeader+":"+name)
+		}
+	}
+	slices.Sort(rv)
+	return rv
+}
+
+// Compares the value found by dot separated path with expected one. Non string values are compared in JSON notation.
+func jsonPathEquals(body []byte, path string, expected string) bool {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return false
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			val, ok := node[key]
+			if !ok {
+				return false
+			}
+			doc = val
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return false
+			}
+			doc = node[idx]
+		default:
+			return false
+		}
+	}
+	if str, ok := doc.(string); ok {
+		return str == expected
+	}
+	encoded, err := json.Marshal(doc)
+	return err == nil && string(encoded) == expected
+}
@@ -0,0 +1,40 @@
+package job
+
+import (
+	"bytes"
+	"errors"
+	"github.com/greggyNapalm/proxychick/pkg/client"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// Target entry of the config file, its request, validation and tcp settings override the global ones.
+type TargetCfg struct {
+	URL        string                 `yaml:"url"`
+	Request    *client.HTTPRequestCfg `yaml:"request"`
+	Validation *client.ValidationCfg  `yaml:"validation"`
+	TCP        *client.TCPProbeCfg    `yaml:"tcp"` // for tcp:// targets
+}
+
+// Job settings that are too verbose for command line flags, loaded from YAML file.
+type FileCfg struct {
+	Request    client.HTTPRequestCfg `yaml:"request"`
+	Validation client.ValidationCfg  `yaml:"validation"`
+	Targets    []TargetCfg           `yaml:"targets"`
+	TCP        client.TCPProbeCfg    `yaml:"tcp"`
+}
+
+func LoadFileCfg(path string) (*FileCfg, error) {
+	rv := &FileCfg{}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("config: Can't read " + path + ": " + err.Error())
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(rv); err != nil && err != io.EOF {
+		return nil, errors.New("config: Can't parse " + path + ": " + err.Error())
+	}
+	return rv, nil
+}
@@ -3,6 +3,8 @@ package job
 import "errors"
 
 var (
-	proxyURLFormatError = errors.New("proxycheck: Unknown Proxy URL format. Please use one og the follow: login:password@host:port or host:port:login:password")
-	transportLayerError = errors.New("proxycheck: Failed to establish TCP connetion to Proxy server")
+	proxyURLFormatError    = errors.New("proxycheck: Unknown Proxy URL format. Please use one og the follow: host:port, login:password@host:port or host:port:login:password")
+	transportLayerError    = errors.New("proxycheck: Failed to establish TCP connetion to Proxy server")
+	protocolDetectionError = errors.New("proxycheck: No supported proxy protocol detected")
+	MaxBytesExceededError  = errors.New("proxycheck: Traffic budget(maxBytes) exceeded, the job was stopped")
 )
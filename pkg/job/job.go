@@ -1,6 +1,8 @@
 package job
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"github.com/greggyNapalm/proxychick/pkg/client"
 	"log"
@@ -8,63 +10,140 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// Proxy URL scheme which makes EvaluateProxyList detect the protocol before the test.
+const SchemeAuto = "auto"
+
+// Target of the test with its own HTTP checker settings.
+type Target struct {
+	URL      url.URL
+	HTTPOpts *client.HTTPTestOpts // nil means PListEvanJobCfg.HTTPOpts
+	TCPOpts  *client.TCPTestOpts  // for tcp:// targets, nil means PListEvanJobCfg.TCPOpts
+}
+
 type PListEvanJobCfg struct {
-	MaxConcurrency int           `json:"MaxConcurrency"`
-	TargetURL      url.URL       `json:"TargetURL"`
-	TimeOut        time.Duration `json:"TimeOut"`
-	Transport      string        `json:"Transport"`
-	Debug          bool          `json:"-"`
+	MaxConcurrency int                    `json:"MaxConcurrency"`
+	TargetURL      url.URL                `json:"TargetURL"`
+	Targets        []Target               `json:"-"` // every proxy is tested against each of them, TargetURL is used if empty
+	TimeOut        time.Duration          `json:"TimeOut"`
+	Transport      string                 `json:"Transport"`
+	Debug          bool                   `json:"-"`
+	HTTPOpts       *client.HTTPTestOpts   `json:"-"`
+	ProxyTLS       *tls.Config            `json:"-"` // proxy leg of client.TLSCfg for the protocol detection of -p auto
+	MaxBytes       int64                  `json:"-"` // no new tests are started once the traffic exceeds it, 0 means no limit
+	Tunnel         *client.TunnelTestOpts `json:"-"` // tunnel stability checker is used instead of the HTTP one
+	TCPOpts        *client.TCPTestOpts    `json:"-"` // raw TCP checker settings for tcp:// targets
+	PortAudit      *client.PortAuditOpts  `json:"-"` // destination port policy audit is used instead of the HTTP one
+	SSRFAudit      *client.SSRFAuditOpts  `json:"-"` // internal network reachability audit is used instead of the HTTP one
+	AuthCheck      *client.AuthCheckOpts  `json:"-"` // proxies with credentials are also probed without them and with the wrong ones
+	UDPStream      *client.UDPStreamCfg   `json:"-"` // UDP quality mode, stream of datagrams instead of the single one
+	UDPProbe       *client.UDPProbeCfg    `json:"-"` // DNS, STUN or NTP request is sent instead of the echo datagram
+	UDPMTU         *client.UDPMTUCfg      `json:"-"` // largest datagram echoed intact is searched instead of the single echo
+	Retry          *RetryCfg              `json:"-"` // failed tests are retried, nil means the single attempt
+	RPS            *RPSCfg                `json:"-"` // tests are started by the schedule instead of MaxConcurrency
 }
 
 func (self PListEvanJobCfg) MarshalJSON() ([]byte, error) {
+	targets := []string{}
+	for _, t := range self.GetTargets() {
+		targets = append(targets, t.URL.String())
+	}
 	return json.Marshal(struct {
-		MaxConcurrency int    `json:"MaxConcurrency"`
-		TargetURL      string `json:"TargetURL"`
-		TimeOut        int    `json:"TimeOut"`
-		Transport      string `json:"Transport"`
+		MaxConcurrency int      `json:"MaxConcurrency"`
+		TargetURL      string   `json:"TargetURL"`
+		Targets        []string `json:"Targets"`
+		TimeOut        int      `json:"TimeOut"`
+		Transport      string   `json:"Transport"`
 	}{
 		self.MaxConcurrency,
 		self.TargetURL.String(),
+		targets,
 		int(self.TimeOut / time.Millisecond),
 		self.Transport,
 	})
 }
 
+// Targets with HTTP checker settings resolved.
+func (self *PListEvanJobCfg) GetTargets() []Target {
+	if len(self.Targets) == 0 {
+		return []Target{{self.TargetURL, self.HTTPOpts, self.TCPOpts}}
+	}
+	rv := []Target{}
+	for _, t := range self.Targets {
+		if t.HTTPOpts == nil {
+			t.HTTPOpts = self.HTTPOpts
+		}
+		if t.TCPOpts == nil {
+			t.TCPOpts = self.TCPOpts
+		}
+		rv = append(rv, t)
+	}
+	return rv
+}
+
+// Number of results EvaluateProxyList sends for the proxy list of prxCnt length.
+func (self *PListEvanJobCfg) TasksCnt(prxCnt int) int {
+	if self.RPS != nil {
+		return self.RPS.Schedule.Count()
+	}
+	return prxCnt * len(self.GetTargets())
+}
+
 type JobMetrics struct {
-	Duration             time.Duration `json:"Duration"`
-	UniqueExitNodesIPCnt int           `json:"UniqueExitNodesIPCnt"`
-	ReqsCnt              int           `json:"ReqsCnt"`
-	RespCnt              int           `json:"RespCnt"`
+	Duration             time.Duration  `json:"Duration"`
+	UniqueExitNodesIPCnt int            `json:"UniqueExitNodesIPCnt"`
+	ReqsCnt              int            `json:"ReqsCnt"`
+	RespCnt              int            `json:"RespCnt"`
+	Traffic              client.Traffic `json:"Traffic"`
+	Cost                 float64        `json:"Cost"`        // estimated by the price per GB, 0 if the price is unknown
+	TargetRPS            float64        `json:"TargetRPS"`   // average rate of the schedule, 0 unless the open model is used
+	AchievedRPS          float64        `json:"AchievedRPS"` // rate the tests were actually started at
 }
 
 func (self JobMetrics) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Duration             int `json:"Duration"`
-		UniqueExitNodesIPCnt int `json:"UniqueExitNodesIPCnt"`
+		Duration             int            `json:"Duration"`
+		UniqueExitNodesIPCnt int            `json:"UniqueExitNodesIPCnt"`
+		Traffic              client.Traffic `json:"Traffic"`
+		Cost                 float64        `json:"Cost"`
+		TargetRPS            float64        `json:"TargetRPS"`
+		AchievedRPS          float64        `json:"AchievedRPS"`
 	}{
 		int(self.Duration / time.Millisecond),
 		self.UniqueExitNodesIPCnt,
+		self.Traffic,
+		self.Cost,
+		self.TargetRPS,
+		self.AchievedRPS,
 	})
 }
 
+// Converts proxylist line to URL. Optional label can be appended after '#', it is kept in the URL Fragment.
 func AdaptRawProxyStr(prxStr string, prxProtocol string) (parsedURL *url.URL, err error) {
-	prxChemas := []string{"http", "https", "socks4", "socks4a", "socks5", "socks5h"}
+	prxChemas := []string{"http", "https", "socks4", "socks4a", "socks5", "socks5h", SchemeAuto}
+	prxStr, label, _ := strings.Cut(prxStr, "#")
+	prxStr = strings.TrimSpace(prxStr)
 	sSplited := strings.Split(prxStr, ":")
 	var prxURLFormated string
 	err = proxyURLFormatError
 
-	if len(sSplited) < 3 {
+	if len(sSplited) < 2 {
 		return
 	} else if slices.Contains(prxChemas, sSplited[0]) { // str starts with protocol
 		// complete URL with the protocol scheme
 		prxURLFormated = prxStr
+	} else if len(sSplited) == 2 {
+		//host:port format
+		if _, err := strconv.Atoi(sSplited[1]); err == nil {
+			prxURLFormated = prxProtocol + "://" + prxStr
+		}
 	} else if _, err := strconv.Atoi(sSplited[2]); err == nil { // last field is port number
 		//login:password@host:port format
 		prxURLFormated = prxProtocol + "://" + prxStr
-	} else if _, err := strconv.Atoi(sSplited[1]); err == nil { // 2nd field is port number
+	} else if _, err := strconv.Atoi(sSplited[1]); err == nil && len(sSplited) == 4 { // 2nd field is port number
 		//host:port:login:password format
 		prxURLFormated = prxProtocol + "://" + sSplited[2] + ":" + sSplited[3] + "@" + sSplited[0] + ":" + sSplited[1]
 	}
@@ -74,35 +153,168 @@ func AdaptRawProxyStr(prxStr string, prxProtocol string) (parsedURL *url.URL, er
 			log.Fatal("Can't parse Proxy URL:" + prxURLFormated)
 			return
 		}
+		parsedURL.Fragment = strings.TrimSpace(label)
 	}
 	return
 }
 
+// Tests each proxy against each target, the proxy × target pairs share MaxConcurrency limit.
+// With cfg.RPS the tests are started by its schedule instead, see evaluateProxyListOpen.
+// ch is closed once all tests are done, that happens before TasksCnt results are sent if MaxBytes is exceeded.
 func EvaluateProxyList(prxURLs []*url.URL, cfg *PListEvanJobCfg, ch chan client.Result) error {
+	if cfg.RPS != nil {
+		return evaluateProxyListOpen(prxURLs, cfg, ch)
+	}
 	chTxConnPool := make(chan struct{}, cfg.MaxConcurrency)
 	for i := 0; i < cfg.MaxConcurrency; i++ {
 		chTxConnPool <- struct{}{}
 	}
+	targets := cfg.GetTargets()
+	spent := &atomic.Int64{}
+	var rv error
 
+dispatch:
 	for _, prxURL := range prxURLs {
-		<-chTxConnPool
-		go func(url url.URL) {
-			var res *client.Result
-			var err error
-			if cfg.Transport == "tcp" {
-				res, err = client.TestHTTP(&cfg.TargetURL, &url, cfg.TimeOut, true)
-				res.EnrichHTTP(err)
-			} else if cfg.Transport == "udp" {
-				res, err = client.TestUDPEcho(&cfg.TargetURL, &url, cfg.TimeOut, true, cfg.Debug)
-				res.EnrichUdpEcho(err)
-			} else {
-				return
+		for _, target := range targets {
+			<-chTxConnPool
+			if cfg.MaxBytes > 0 && spent.Load() > cfg.MaxBytes {
+				chTxConnPool <- struct{}{}
+				rv = MaxBytesExceededError
+				break dispatch
 			}
-			if ch != nil {
-				ch <- *res
+			go evaluateProxy(*prxURL, target, cfg, ch, chTxConnPool, spent, nil)
+		}
+	}
+	for i := 0; i < cfg.MaxConcurrency; i++ {
+		<-chTxConnPool
+	}
+	if ch != nil {
+		close(ch)
+	}
+	return rv
+}
+
+// Tests the proxy against the target, slot is the schedule time of the open model, nil in the closed one.
+func evaluateProxy(url url.URL, target Target, cfg *PListEvanJobCfg, ch chan client.Result, chTxConnPool chan struct{}, spent *atomic.Int64, slot *loadSlot) {
+	defer func() { chTxConnPool <- struct{}{} }()
+	started := time.Now()
+	var res *client.Result
+	label := url.Fragment
+	url.Fragment = ""
+	var detected client.StrList
+	var detectTraffic client.Traffic
+	if url.Scheme == SchemeAuto {
+		detected, detectTraffic = client.DetectProtocols(&url, &target.URL, cfg.TimeOut, cfg.ProxyTLS)
+		if scheme := client.BestDetectedScheme(detected, url.User != nil); scheme != "" {
+			url.Scheme = scheme
+		}
+	}
+	if url.Scheme == SchemeAuto {
+		res = &client.Result{ProxyURL: client.URL{URL: url}, TargetURL: client.URL{URL: target.URL}, Ts: time.Now()}
+		res.EnrichHTTP(protocolDetectionError)
+	} else if res = retryTest(url, target, cfg); res == nil {
+		return
+	}
+	if cfg.AuthCheck != nil && cfg.Transport == "tcp" && url.Scheme != SchemeAuto {
+		var authTraffic client.Traffic
+		res.Auth, authTraffic = client.CheckAuth(&url, &target.URL, cfg.TimeOut, cfg.AuthCheck)
+		res.Traffic = res.Traffic.Add(authTraffic)
+	}
+	if slot != nil {
+		res.Load.Scheduled = int(slot.due.Milliseconds())
+		res.Load.Lag = int(started.Sub(slot.started.Add(slot.due)).Milliseconds())
+		if res.Status {
+			res.Load.TTFB = res.Latency.TTFB + res.Load.Lag
+		}
+	}
+	res.Label = label
+	res.DetectedProtocols = detected
+	res.Traffic = res.Traffic.Add(detectTraffic)
+	spent.Add(res.Traffic.Total())
+	if ch != nil {
+		ch <- *res
+	}
+}
+
+// Result of the checker the job is configured with, nil for the unknown transport.
+func runTest(url url.URL, target Target, cfg *PListEvanJobCfg) *client.Result {
+	var res *client.Result
+	var err error
+	if cfg.Transport == "tcp" && cfg.Tunnel != nil {
+		res, err = client.TestTunnel(&target.URL, &url, cfg.TimeOut, cfg.Tunnel)
+		res.EnrichHTTP(err)
+	} else if cfg.Transport == "tcp" && cfg.PortAudit != nil {
+		res, err = client.TestPorts(&target.URL, &url, cfg.TimeOut, cfg.PortAudit)
+		res.EnrichHTTP(err)
+	} else if cfg.Transport == "tcp" && cfg.SSRFAudit != nil {
+		res, err = client.TestSSRF(&target.URL, &url, cfg.TimeOut, cfg.SSRFAudit)
+		res.EnrichHTTP(err)
+	} else if cfg.Transport == "tcp" && target.URL.Scheme == "tcp" {
+		res, err = client.TestTCP(&target.URL, &url, cfg.TimeOut, true, target.TCPOpts)
+		res.EnrichHTTP(err)
+	} else if cfg.Transport == "tcp" {
+		res, err = client.TestHTTP(&target.URL, &url, cfg.TimeOut, true, target.HTTPOpts)
+		res.EnrichHTTP(err)
+	} else if cfg.Transport == "udp" {
+		res = runUDPTest(url, target, cfg)
+	}
+	return res
+}
+
+// Result of the UDP checker, the whole test including the association gets cfg.TimeOut.
+// Stream and datagram size modes get their own budgets as they take several exchanges.
+func runUDPTest(url url.URL, target Target, cfg *PListEvanJobCfg) *client.Result {
+	budget := cfg.TimeOut
+	if cfg.UDPStream != nil {
+		budget = cfg.UDPStream.Budget(cfg.TimeOut)
+	} else if cfg.UDPMTU != nil {
+		budget = cfg.UDPMTU.Budget(cfg.TimeOut)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+	var res *client.Result
+	var err error
+	if cfg.UDPStream != nil {
+		res, err = client.TestUDPStream(ctx, &target.URL, &url, cfg.TimeOut, cfg.UDPStream)
+	} else if cfg.UDPMTU != nil {
+		res, err = client.TestUDPMTU(ctx, &target.URL, &url, cfg.TimeOut, cfg.UDPMTU)
+	} else if cfg.UDPProbe != nil {
+		res, err = client.TestUDPProbe(ctx, &target.URL, &url, cfg.TimeOut, cfg.UDPProbe)
+	} else {
+		res, err = client.TestUDPEcho(ctx, &target.URL, &url, cfg.TimeOut, true, cfg.Debug)
+	}
+	res.EnrichUdpEcho(err)
+	return res
+}
+
+// Runs the test until it succeeds, its error isn't retryable or cfg.Retry attempts are exhausted.
+// Every attempt is recorded and the traffic of all of them is summed up when retries are on.
+func retryTest(url url.URL, target Target, cfg *PListEvanJobCfg) *client.Result {
+	if cfg.Retry == nil {
+		return runTest(url, target, cfg)
+	}
+	attempts := client.AttemptList{}
+	traffic := client.Traffic{}
+	for n := 1; ; n++ {
+		started := time.Now()
+		res := runTest(url, target, cfg)
+		if res == nil {
+			return nil
+		}
+		attempt := client.Attempt{N: n, Latency: int(time.Since(started).Milliseconds())}
+		if !res.Status {
+			attempt.Category = ErrorCategory(res)
+			if res.Error.Err != nil {
+				attempt.Error = res.Error.Err.Error()
 			}
-			chTxConnPool <- struct{}{}
-		}(*prxURL)
+		}
+		attempts = append(attempts, attempt)
+		traffic = traffic.Add(res.Traffic)
+		if res.Status || n > cfg.Retry.Retries || !slices.Contains(cfg.Retry.On, attempt.Category) {
+			res.Attempts = attempts
+			res.Traffic = traffic
+			return res
+		}
+		time.Sleep(cfg.Retry.backoff(n))
 	}
-	return nil
 }
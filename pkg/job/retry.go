@@ -0,0 +1,72 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/greggyNapalm/proxychick/pkg/client"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Categories of the errors the failed tests are retried on.
+const (
+	ErrCategoryTimeout  = "timeout"  // any timeout, including the exceeded budgets of the HTTP checker
+	ErrCategoryReset    = "reset"    // connection reset by peer or broken pipe
+	ErrCategoryEOF      = "eof"      // connection closed by peer mid-test
+	ErrCategoryRefused  = "refused"  // connection to the proxy refused
+	ErrCategoryProxy5xx = "proxy5xx" // proxy replied with 5xx status code
+	ErrCategoryOther    = "other"
+)
+
+var ErrCategories = []string{ErrCategoryTimeout, ErrCategoryReset, ErrCategoryEOF, ErrCategoryRefused, ErrCategoryProxy5xx, ErrCategoryOther}
+
+// Transient errors retried by default.
+var DefaultRetryOn = []string{ErrCategoryTimeout, ErrCategoryReset, ErrCategoryEOF}
+
+// Retry policy of the failed tests.
+type RetryCfg struct {
+	Retries    int           // attempts after the first one
+	Backoff    time.Duration // pause before the first retry, doubled before each next one
+	MaxBackoff time.Duration // longest pause, 0 means no limit
+	On         []string      // ErrCategories the test is retried on
+}
+
+// Pause before the retry number retry(starting from 1).
+func (self *RetryCfg) backoff(retry int) time.Duration {
+	d := self.Backoff
+	for i := 1; i < retry && d > 0 && (self.MaxBackoff <= 0 || d < self.MaxBackoff); i++ {
+		d *= 2
+	}
+	if self.MaxBackoff > 0 && d > self.MaxBackoff {
+		d = self.MaxBackoff
+	}
+	return d
+}
+
+// Category of the error the test failed with, one of ErrCategories.
+// Checkers flatten some of the errors into messages, so the message is matched as well.
+func ErrorCategory(res *client.Result) string {
+	err := res.Error.Err
+	if res.ProxyStatusCode >= 500 {
+		return ErrCategoryProxy5xx
+	}
+	if err == nil {
+		return ErrCategoryOther
+	}
+	var netErr net.Error
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout(), errors.Is(err, context.DeadlineExceeded), strings.Contains(msg, "timeout"):
+		return ErrCategoryTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), strings.Contains(msg, "connection reset"), strings.Contains(msg, "broken pipe"):
+		return ErrCategoryReset
+	case errors.Is(err, syscall.ECONNREFUSED), strings.Contains(msg, "connection refused"):
+		return ErrCategoryRefused
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), strings.HasSuffix(msg, "eof"):
+		return ErrCategoryEOF
+	}
+	return ErrCategoryOther
+}
@@ -0,0 +1,85 @@
+package job
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/greggyNapalm/proxychick/pkg/client"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestErrorCategory(t *testing.T) {
+	dialErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1080}, Err: err}
+	}
+	cases := []struct {
+		name      string
+		err       error
+		proxyCode int
+		category  string
+	}{
+		// refused
+		{"refused", dialErr(os.NewSyscallError("connect", syscall.ECONNREFUSED)), 0, ErrCategoryRefused},
+		{"refused via proxyconnect", fmt.Errorf("proxyconnect tcp: %w", dialErr(os.NewSyscallError("connect", syscall.ECONNREFUSED))), 0, ErrCategoryRefused},
+		{"refused flattened", errors.New("socks connect tcp 127.0.0.1:1080->example.com:443: dial tcp 127.0.0.1:1080: connect: connection refused"), 0, ErrCategoryRefused},
+		// timeout
+		{"dial timeout", dialErr(&timeoutError{}), 0, ErrCategoryTimeout},
+		{"context deadline", fmt.Errorf("c2t: %w", context.DeadlineExceeded), 0, ErrCategoryTimeout},
+		{"budget exceeded", errors.New("timeout: ttfb budget exceeded"), 0, ErrCategoryTimeout},
+		{"udp phase timeout", errors.New("c2p socks5: UDP ASSOCIATE timeout"), 0, ErrCategoryTimeout},
+		{"tls handshake timeout", errors.New("c2p tls: TLS handshake timeout"), 0, ErrCategoryTimeout},
+		// DNS
+		{"dns not found", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, 0, ErrCategoryOther},
+		{"dns not found flattened", errors.New("lookup example.invalid on 10.0.0.53:53: no such host"), 0, ErrCategoryOther},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, 0, ErrCategoryTimeout},
+		{"dns server failure", &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, 0, ErrCategoryOther},
+		// TLS
+		{"tls unknown authority", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, 0, ErrCategoryOther},
+		{"tls alert", fmt.Errorf("c2p tls: %w", tls.AlertError(40)), 0, ErrCategoryOther},
+		{"tls hostname mismatch", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"}, 0, ErrCategoryOther},
+		{"tls closed in handshake", errors.New("proxyconnect tcp: c2p tls: EOF"), 0, ErrCategoryEOF},
+		// proxy auth
+		{"http 407", errors.New("http connect: 407 Proxy Authentication Required"), 407, ErrCategoryOther},
+		{"socks5 auth failure", errors.New("socks5: Auth failure"), 0, ErrCategoryOther},
+		// the rest
+		{"reset", dialErr(os.NewSyscallError("read", syscall.ECONNRESET)), 0, ErrCategoryReset},
+		{"broken pipe flattened", errors.New("write tcp 127.0.0.1:5000->127.0.0.1:1080: write: broken pipe"), 0, ErrCategoryReset},
+		{"eof", fmt.Errorf("c2t: %w", io.EOF), 0, ErrCategoryEOF},
+		{"unexpected eof", io.ErrUnexpectedEOF, 0, ErrCategoryEOF},
+		{"proxy 502", errors.New("http connect: 502 Bad Gateway"), 502, ErrCategoryProxy5xx},
+		{"proxy 503 without error", nil, 503, ErrCategoryProxy5xx},
+		{"no error", nil, 0, ErrCategoryOther},
+		{"socks host unreachable", errors.New("socks5: CONNECT host unreachable"), 0, ErrCategoryOther},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &client.Result{Error: client.PChickError{Err: c.err}, ProxyStatusCode: c.proxyCode}
+			if got := ErrorCategory(res); got != c.category {
+				t.Errorf("ErrorCategory(%v) = %q, want %q", c.err, got, c.category)
+			}
+		})
+	}
+}
+
+// net.Error of the expired deadline.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryBackoff(t *testing.T) {
+	cfg := &RetryCfg{Backoff: 200 * time.Millisecond, MaxBackoff: time.Second}
+	for retry, want := range map[int]time.Duration{1: 200 * time.Millisecond, 2: 400 * time.Millisecond, 3: 800 * time.Millisecond, 4: time.Second, 10: time.Second} {
+		if got := cfg.backoff(retry); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", retry, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package job
+
+import (
+	"errors"
+	"github.com/greggyNapalm/proxychick/pkg/client"
+	"math"
+	url "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Safety cap of the tests running at once in the open model, the schedule lags behind once it's reached.
+const DefaultMaxInFlight = 1000
+
+// Float error of the summed segment counts and of the step rates, so e.g. ten const(0.1,1s) make exactly one request.
+const rpsCountTolerance = 1e-9
+
+// Part of the load schedule, the rate changes linearly from From to To requests per second.
+type RPSSegment struct {
+	From     float64
+	To       float64
+	Duration time.Duration
+}
+
+// Requests started during the segment.
+func (self RPSSegment) count() float64 {
+	return (self.From + self.To) / 2 * self.Duration.Seconds()
+}
+
+// Time since the segment start the request number n(starting from 0) is due, n(t) = From*t + (To-From)*t²/2D solved for t.
+func (self RPSSegment) at(n float64) time.Duration {
+	slope := (self.To - self.From) / self.Duration.Seconds()
+	var secs float64
+	if slope == 0 {
+		secs = n / self.From
+	} else {
+		secs = (-self.From + math.Sqrt(self.From*self.From+2*slope*n)) / slope
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Load schedule of the open model, segments follow each other.
+type RPSSchedule []RPSSegment
+
+var (
+	rpsSegmentRe = regexp.MustCompile(`^(const|line|step)\(([^()]*)\)$`)
+	rpsCommaRe   = regexp.MustCompile(`\s*,\s*`)
+)
+
+// Parses Yandex.Tank like schedule: space separated const(RPS,DURATION), line(FROM,TO,DURATION) and step(FROM,TO,STEP,DURATION) segments.
+// DURATION is Go duration, plain number means seconds.
+func ParseRPSSchedule(s string) (RPSSchedule, error) {
+	rv := RPSSchedule{}
+	for _, seg := range strings.Fields(rpsCommaRe.ReplaceAllString(s, ",")) {
+		m := rpsSegmentRe.FindStringSubmatch(seg)
+		if m == nil {
+			return nil, errors.New("rps: Bad schedule segment " + seg)
+		}
+		args := strings.Split(m[2], ",")
+		argsCnt := map[string]int{"const": 2, "line": 3, "step": 4}[m[1]]
+		if len(args) != argsCnt {
+			return nil, errors.New("rps: " + m[1] + " takes " + strconv.Itoa(argsCnt) + " arguments, got " + seg)
+		}
+		rates := []float64{}
+		for _, arg := range args[:argsCnt-1] {
+			rate, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil || rate < 0 {
+				return nil, errors.New("rps: Bad rate " + arg + " in " + seg)
+			}
+			rates = append(rates, rate)
+		}
+		durStr := strings.TrimSpace(args[argsCnt-1])
+		if _, err := strconv.ParseFloat(durStr, 64); err == nil {
+			durStr += "s"
+		}
+		dur, err := time.ParseDuration(durStr)
+		if err != nil || dur <= 0 {
+			return nil, errors.New("rps: Bad duration " + args[argsCnt-1] + " in " + seg)
+		}
+		switch m[1] {
+		case "const":
+			rv = append(rv, RPSSegment{rates[0], rates[0], dur})
+		case "line":
+			rv = append(rv, RPSSegment{rates[0], rates[1], dur})
+		case "step":
+			from, to, step := rates[0], rates[1], rates[2]
+			if step == 0 {
+				return nil, errors.New("rps: Zero step in " + seg)
+			}
+			if from > to {
+				step = -step
+			}
+			// rates aren't accumulated, so the float error doesn't drop the last step
+			steps := int(math.Floor((to-from)/step + rpsCountTolerance))
+			for i := 0; i <= steps; i++ {
+				rate := from + float64(i)*step
+				rv = append(rv, RPSSegment{rate, rate, dur})
+			}
+		}
+	}
+	if rv.Count() == 0 {
+		return nil, errors.New("rps: Schedule has no requests")
+	}
+	return rv, nil
+}
+
+// Time since the load start the request number n(starting from 0) is due, false once the schedule is over.
+func (self RPSSchedule) at(n int) (time.Duration, bool) {
+	if n >= self.Count() {
+		return 0, false
+	}
+	var offset time.Duration
+	left := float64(n)
+	for _, seg := range self {
+		if cnt := seg.count(); left < cnt {
+			return offset + seg.at(left), true
+		}
+		left -= seg.count()
+		offset += seg.Duration
+	}
+	// float error of the last request
+	return offset, true
+}
+
+// Requests started by the schedule: every request due before the schedule end, so the fractional total is rounded up,
+// e.g. const(0.5,1s) starts the single request at 0s.
+func (self RPSSchedule) Count() int {
+	var total float64
+	for _, seg := range self {
+		total += seg.count()
+	}
+	return int(math.Ceil(total - rpsCountTolerance))
+}
+
+func (self RPSSchedule) Duration() time.Duration {
+	var rv time.Duration
+	for _, seg := range self {
+		rv += seg.Duration
+	}
+	return rv
+}
+
+// Average rate of the schedule, requests per second.
+func (self RPSSchedule) Rate() float64 {
+	return float64(self.Count()) / self.Duration().Seconds()
+}
+
+// Rate the results were started at, requests per second. It's the schedule rate unless the starts lagged behind past the schedule end.
+func (self RPSSchedule) AchievedRate(results []*client.Result) float64 {
+	span := self.Duration()
+	for _, r := range results {
+		span = max(span, time.Duration(r.Load.Scheduled+r.Load.Lag)*time.Millisecond)
+	}
+	return float64(len(results)) / span.Seconds()
+}
+
+// Open model of the load: tests are started by the schedule regardless of the running ones.
+type RPSCfg struct {
+	Schedule    RPSSchedule
+	MaxInFlight int // tests running at once, the schedule lags behind once it's reached
+}
+
+// Time the test was due by the schedule.
+type loadSlot struct {
+	started time.Time // load start
+	due     time.Duration
+}
+
+// Starts the tests by cfg.RPS schedule, proxy × target pairs are taken in turn until the schedule is over.
+func evaluateProxyListOpen(prxURLs []*url.URL, cfg *PListEvanJobCfg, ch chan client.Result) error {
+	chTxConnPool := make(chan struct{}, cfg.RPS.MaxInFlight)
+	for i := 0; i < cfg.RPS.MaxInFlight; i++ {
+		chTxConnPool <- struct{}{}
+	}
+	targets := cfg.GetTargets()
+	spent := &atomic.Int64{}
+	var rv error
+
+	started := time.Now()
+	for n := 0; len(prxURLs) > 0; n++ {
+		due, ok := cfg.RPS.Schedule.at(n)
+		if !ok {
+			break
+		}
+		time.Sleep(time.Until(started.Add(due)))
+		<-chTxConnPool
+		if cfg.MaxBytes > 0 && spent.Load() > cfg.MaxBytes {
+			chTxConnPool <- struct{}{}
+			rv = MaxBytesExceededError
+			break
+		}
+		pair := n % (len(prxURLs) * len(targets))
+		go evaluateProxy(*prxURLs[pair/len(targets)], targets[pair%len(targets)], cfg, ch, chTxConnPool, spent, &loadSlot{started, due})
+	}
+	for i := 0; i < cfg.RPS.MaxInFlight; i++ {
+		<-chTxConnPool
+	}
+	if ch != nil {
+		close(ch)
+	}
+	return rv
+}
@@ -0,0 +1,129 @@
+package job
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRPSSchedule(t *testing.T) {
+	cases := []struct {
+		schedule string
+		want     RPSSchedule
+	}{
+		{"const(10,1s)", RPSSchedule{{10, 10, time.Second}}},
+		{"const(5, 500ms)", RPSSchedule{{5, 5, 500 * time.Millisecond}}},
+		{"const(2,3)", RPSSchedule{{2, 2, 3 * time.Second}}},
+		{"line(0,10,2s)", RPSSchedule{{0, 10, 2 * time.Second}}},
+		{"step(10,30,10,1s)", RPSSchedule{{10, 10, time.Second}, {20, 20, time.Second}, {30, 30, time.Second}}},
+		{"step(30,10,10,1s)", RPSSchedule{{30, 30, time.Second}, {20, 20, time.Second}, {10, 10, time.Second}}},
+		{"const(1,2s) line(1, 3, 2s)", RPSSchedule{{1, 1, 2 * time.Second}, {1, 3, 2 * time.Second}}},
+		{"const(0.5,1s)", RPSSchedule{{0.5, 0.5, time.Second}}},
+		{"step(0.1,0.3,0.1,10s)", RPSSchedule{{0.1, 0.1, 10 * time.Second}, {0.2, 0.2, 10 * time.Second}, {0.3, 0.3, 10 * time.Second}}},
+	}
+	for _, c := range cases {
+		t.Run(c.schedule, func(t *testing.T) {
+			got, err := ParseRPSSchedule(c.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("ParseRPSSchedule() = %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i].Duration != c.want[i].Duration || math.Abs(got[i].From-c.want[i].From) > 1e-9 || math.Abs(got[i].To-c.want[i].To) > 1e-9 {
+					t.Errorf("ParseRPSSchedule() = %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRPSScheduleInvalid(t *testing.T) {
+	cases := map[string]string{
+		"":                 "no requests",
+		"const(0,1s)":      "no requests",
+		"const(1)":         "takes 2 arguments",
+		"line(1,2)":        "takes 3 arguments",
+		"step(1,5,1)":      "takes 4 arguments",
+		"foo(1,1s)":        "Bad schedule segment",
+		"const(1,1s":       "Bad schedule segment",
+		"const(-1,1s)":     "Bad rate",
+		"const(x,1s)":      "Bad rate",
+		"const(1,0s)":      "Bad duration",
+		"const(1,abc)":     "Bad duration",
+		"step(1,5,0,1s)":   "Zero step",
+		"const(1,1s) oops": "Bad schedule segment",
+	}
+	for schedule, errMsg := range cases {
+		t.Run(schedule, func(t *testing.T) {
+			got, err := ParseRPSSchedule(schedule)
+			if err == nil {
+				t.Fatalf("ParseRPSSchedule() = %v, want error", got)
+			}
+			if !strings.HasPrefix(err.Error(), "rps: ") || !strings.Contains(err.Error(), errMsg) {
+				t.Errorf("ParseRPSSchedule() error = %q, want it to contain %q", err, errMsg)
+			}
+		})
+	}
+}
+
+func TestRPSScheduleAt(t *testing.T) {
+	cases := []struct {
+		schedule string
+		count    int
+		due      []time.Duration // of the requests 0..count-1 given, the rest are skipped
+	}{
+		{"const(10,1s)", 10, []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}},
+		// n(t) = 2.5t², so the request n is due at √(0.4n)s
+		{"line(0,10,2s)", 10, []time.Duration{0, 632455532 * time.Nanosecond, 894427191 * time.Nanosecond}},
+		{"step(10,30,10,1s)", 60, []time.Duration{0, 100 * time.Millisecond}},
+		{"const(1,2s) line(1,3,2s)", 6, []time.Duration{0, time.Second, 2 * time.Second, 2732050807 * time.Nanosecond}},
+		{"const(0.5,1s)", 1, []time.Duration{0}},
+		{"const(1.5,2s)", 3, []time.Duration{0, 666666666 * time.Nanosecond, 1333333333 * time.Nanosecond}},
+		{"const(0.5,1s) const(0.5,1s)", 1, []time.Duration{0}},
+		{"const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s) const(0.1,1s)", 1, []time.Duration{0}},
+		{"const(0.3,10s) const(0.7,10s)", 10, []time.Duration{0, 3333333333 * time.Nanosecond}},
+		{"step(0.1,0.3,0.1,10s)", 6, []time.Duration{0, 10 * time.Second, 15 * time.Second, 20 * time.Second}},
+	}
+	for _, c := range cases {
+		t.Run(c.schedule, func(t *testing.T) {
+			s, err := ParseRPSSchedule(c.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Count() != c.count {
+				t.Errorf("Count() = %d, want %d", s.Count(), c.count)
+			}
+			for n, want := range c.due {
+				got, ok := s.at(n)
+				if !ok || (got-want).Abs() > time.Microsecond {
+					t.Errorf("at(%d) = %v, %v, want %v, true", n, got, ok, want)
+				}
+			}
+			// every request is due within the schedule and in order
+			prev := time.Duration(0)
+			for n := 0; n < c.count; n++ {
+				got, ok := s.at(n)
+				if !ok || got < prev || got > s.Duration() {
+					t.Fatalf("at(%d) = %v, %v, want due after %v within %v", n, got, ok, prev, s.Duration())
+				}
+				prev = got
+			}
+			if got, ok := s.at(c.count); ok {
+				t.Errorf("at(%d) = %v, true, want the schedule over", c.count, got)
+			}
+		})
+	}
+}
+
+func TestRPSScheduleRate(t *testing.T) {
+	s, err := ParseRPSSchedule("line(0,10,2s) const(10,2s)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Duration() != 4*time.Second || s.Rate() != 7.5 {
+		t.Errorf("Duration() = %v, Rate() = %v, want 4s, 7.5", s.Duration(), s.Rate())
+	}
+}
@@ -0,0 +1,119 @@
+// Local stand-in target the proxies can be tested against.
+package judge
+
+import (
+	"fmt"
+	"github.com/greggyNapalm/proxychick/pkg/client"
+	"github.com/greggyNapalm/proxychick/pkg/utils"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Payload is written with this chunk repeated, it isn't all zeros to keep compressing middleboxes honest.
+var payloadChunk = func() []byte {
+	rv := make([]byte, 32<<10)
+	for i := range rv {
+		rv[i] = byte(i*7 + i>>8)
+	}
+	return rv
+}()
+
+// Largest payload of /bytes/{size}, so a single request can't make the judge stream endlessly.
+const MaxPayloadSize = 10 << 30
+
+// HTTP judge, request body is read and discarded on every path:
+//
+//	/bytes/{size}  replies with payload of size bytes up to MaxPayloadSize, e.g. /bytes/50MB
+//	/upload        replies with the number of request body bytes received
+//	/ip            replies with the client(exit node) IP address
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ip", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		fmt.Fprintln(w, host)
+	})
+	mux.HandleFunc("/bytes/", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		size, err := utils.ParseSize(strings.TrimPrefix(r.URL.Path, "/bytes/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if size > MaxPayloadSize {
+			http.Error(w, "judge: Payload size is limited to "+utils.FormatSize(MaxPayloadSize), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		for size > 0 {
+			chunk := payloadChunk[:min(size, int64(len(payloadChunk)))]
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			size -= int64(len(chunk))
+		}
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, "%d\n", n)
+	})
+	return mux
+}
+
+// Serves the judge on addr until the listener fails.
+func ListenAndServe(addr string) error {
+	log.Printf("judge: HTTP on %s", addr)
+	return http.ListenAndServe(addr, NewHandler())
+}
+
+// Serves the SSRF canary on addr until the listener fails, every request is logged and replied with the canary marker.
+// It is placed on the internal address the audited proxies must not reach, e.g. loopback of the proxy host.
+func ListenAndServeCanary(addr string) error {
+	log.Printf("judge: SSRF canary on %s", addr)
+	return http.ListenAndServe(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		log.Printf("judge: SSRF canary hit from %s: %s %s", r.RemoteAddr, r.Method, r.URL)
+		fmt.Fprintln(w, client.SSRFCanaryMarker)
+	}))
+}
+
+// Serves TCP echo on addr until the listener fails, every byte received is sent back.
+func ListenAndServeEcho(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("judge: TCP echo on %s", addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+	}
+}
+
+// Serves UDP echo on addr until the listener fails, every datagram is sent back to its sender.
+func ListenAndServeUDPEcho(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("judge: UDP echo on %s", addr)
+	buf := make([]byte, 64<<10)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		conn.WriteTo(buf[:n], from)
+	}
+}
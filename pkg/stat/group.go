@@ -0,0 +1,183 @@
+package stat
+
+import (
+	"errors"
+	"fmt"
+	"github.com/greggyNapalm/proxychick/pkg/client"
+	"github.com/greggyNapalm/proxychick/pkg/job"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/montanaflynn/stats"
+	"github.com/oschwald/geoip2-golang"
+	"golang.org/x/exp/maps"
+	"io"
+	"slices"
+)
+
+var GroupByDimensions = []string{"host", "scheme", "country", "asn", "label", "target"}
+
+const groupUnknown = "unknown"
+
+// Maps test Result to the name of the group it belongs to.
+type GroupKeyFunc func(r *client.Result) string
+
+// Returns GroupKeyFunc for the dimension, country and asn dimensions require corresponding mmdb.
+func NewGroupKeyFunc(dimension string, countryDB *geoip2.Reader, asnDB *geoip2.Reader) (GroupKeyFunc, error) {
+	switch dimension {
+	case "host":
+		return func(r *client.Result) string { return r.ProxyURL.Hostname() }, nil
+	case "scheme":
+		return func(r *client.Result) string { return r.ProxyURL.Scheme }, nil
+	case "label":
+		return func(r *client.Result) string {
+			if r.Label == "" {
+				return groupUnknown
+			}
+			return r.Label
+		}, nil
+	case "target":
+		return func(r *client.Result) string { return r.TargetURL.String() }, nil
+	case "country":
+		if countryDB == nil {
+			return nil, errors.New("groupBy: country dimension requires GeoLite2-Country.mmdb")
+		}
+		return func(r *client.Result) string {
+			geo, err := getCountyByIp(r.ProxyNodeIPAddr, *countryDB)
+			if err != nil || geo.CountryISO == "" {
+				return groupUnknown
+			}
+			return geo.CountryISO
+		}, nil
+	case "asn":
+		if asnDB == nil {
+			return nil, errors.New("groupBy: asn dimension requires GeoLite2-ASN.mmdb")
+		}
+		return func(r *client.Result) string {
+			if r.ProxyNodeIPAddr == nil {
+				return groupUnknown
+			}
+			record, err := asnDB.ASN(r.ProxyNodeIPAddr)
+			if err != nil || record.AutonomousSystemNumber == 0 {
+				return groupUnknown
+			}
+			return fmt.Sprintf("AS%d - %s", record.AutonomousSystemNumber, record.AutonomousSystemOrganization)
+		}, nil
+	}
+	return nil, errors.New("groupBy: unsupported dimension " + dimension)
+}
+
+func groupResults(results []*client.Result, keyFn GroupKeyFunc) (map[string][]*client.Result, []string) {
+	groups := make(map[string][]*client.Result)
+	for _, r := range results {
+		k := keyFn(r)
+		groups[k] = append(groups[k], r)
+	}
+	names := maps.Keys(groups)
+	slices.Sort(names)
+	return groups, names
+}
+
+// Same tables as ProcTestResults, but printed for each group separately.
+func ProcGroupedTestResults(results []*client.Result, outputs []io.Writer, trasnport string, dimension string, keyFn GroupKeyFunc) []ProxyChickStatTable {
+	rv := []ProxyChickStatTable{}
+	groups, names := groupResults(results, keyFn)
+	for _, name := range names {
+		groupMetrics := job.JobMetrics{}
+		rv = append(rv, procTestResults(groups[name], outputs, trasnport, &groupMetrics, fmt.Sprintf(" [%s=%s]", dimension, name))...)
+	}
+	return rv
+}
+
+type TablePivotRow struct {
+	Group     string             `json:"group"`
+	Count     int                `json:"count"`
+	SuccRate  float64            `json:"succRate"`
+	Quantiles map[string]float64 `json:"quantiles"`
+}
+
+// Groups as rows, success rate and TTFB percentiles as columns.
+type TablePivot struct {
+	Name        string           `json:"name"`
+	TableType   string           `json:"TableType"`
+	Headers     table.Row        `json:"headers"`
+	Rows        []*TablePivotRow `json:"rows"`
+	outputs     []io.Writer
+	Percentiles []float64 `json:"-"`
+	groups      map[string][]*client.Result
+	groupNames  []string
+}
+
+func NewTablePivot(tblName string, outputs []io.Writer, dimension string, groups map[string][]*client.Result, groupNames []string) *TablePivot {
+	var c TablePivot
+	c.Name = tblName
+	c.TableType = "pivot"
+	c.Percentiles = defaultPercentiles
+	header := table.Row{dimension, "count", "success %"}
+	for _, pVal := range c.Percentiles {
+		header = append(header, fmt.Sprintf("TTFB %.0f", pVal))
+	}
+	c.Headers = header
+	c.outputs = outputs
+	c.groups = groups
+	c.groupNames = groupNames
+	return &c
+}
+
+func (self *TablePivot) add(s string) {
+}
+
+func (self *TablePivot) getCounters() map[string]int {
+	rv := make(map[string]int)
+	for _, r := range self.Rows {
+		rv[r.Group] = r.Count
+	}
+	return rv
+}
+
+func (self *TablePivot) createTable() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(self.Headers)
+	self.Rows = nil
+	for _, name := range self.groupNames {
+		pRow := &TablePivotRow{Group: name, Quantiles: make(map[string]float64)}
+		var ttfb []float64
+		succCnt := 0
+		for _, r := range self.groups[name] {
+			pRow.Count++
+			if r.Status {
+				succCnt++
+				ttfb = append(ttfb, float64(r.Latency.TTFB))
+			}
+		}
+		pRow.SuccRate = float64(succCnt) / float64(pRow.Count) * 100
+		row := table.Row{name, pRow.Count, fmt.Sprintf("%.2f", pRow.SuccRate)}
+		for _, p := range self.Percentiles {
+			pName := fmt.Sprintf("%.0f", p)
+			if quantile, err := stats.Percentile(ttfb, p); err == nil {
+				pRow.Quantiles[pName] = quantile
+			}
+			row = append(row, fmt.Sprintf("%.0f", pRow.Quantiles[pName]))
+		}
+		self.Rows = append(self.Rows, pRow)
+		t.AppendRow(row)
+	}
+	return t
+}
+
+func (self *TablePivot) PrintTable() {
+	w := self.createTable()
+	if len(self.outputs) > 0 {
+		for _, o := range self.outputs {
+			o.Write([]byte(fmt.Sprintf("\n%s\n", self.Name)))
+			w.SetOutputMirror(o)
+			w.Render()
+		}
+	}
+}
+
+// Pivot table with one row per group.
+func ProcPivotTestResults(results []*client.Result, outputs []io.Writer, dimension string, keyFn GroupKeyFunc) []ProxyChickStatTable {
+	groups, names := groupResults(results, keyFn)
+	tbl := NewTablePivot("Pivot by "+dimension, outputs, dimension, groups, names)
+	tbl.PrintTable()
+	return []ProxyChickStatTable{tbl}
+}
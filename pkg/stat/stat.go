@@ -10,6 +10,7 @@ import (
 	"golang.org/x/exp/maps"
 	"io"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -128,7 +129,7 @@ type TableMesurable struct {
 	Rows        []*ColumnMesurable `json:"rows"`
 	outputs     []io.Writer        `json:"-"`
 	Percentiles []float64          `json:"-"`
-	percentiles map[string]float64 `json:"percentiles"`
+	percentiles map[string]float64 `json:"-"`
 	Metrics     []*ColumnMesurable `json:"-"`
 }
 
@@ -179,31 +180,570 @@ func (self *TableMesurable) PrintTable() {
 	}
 }
 
+// Container for a value per row and column, e.g. port policy of each proxy.
+type TableMatrix struct {
+	Name      string      `json:"name"`
+	TableType string      `json:"TableType"`
+	Headers   table.Row   `json:"headers"`
+	Rows      []table.Row `json:"rows"`
+	outputs   []io.Writer `json:"-"`
+}
+
+func NewTableMatrix(tblName string, outputs []io.Writer, headers table.Row) *TableMatrix {
+	var c TableMatrix
+	c.Name = tblName
+	c.TableType = "matrix"
+	c.Headers = headers
+	c.outputs = outputs
+	return &c
+}
+
+func (self *TableMatrix) add(s string) {
+}
+func (self *TableMatrix) getCounters() map[string]int {
+	return make(map[string]int)
+}
+
+func (self *TableMatrix) addRow(row table.Row) {
+	self.Rows = append(self.Rows, row)
+}
+
+func (self *TableMatrix) createTable() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(self.Headers)
+	t.AppendRows(self.Rows)
+	return t
+}
+func (self *TableMatrix) PrintTable() {
+	w := self.createTable()
+	for _, o := range self.outputs {
+		o.Write([]byte(fmt.Sprintf("\n%s\n", self.Name)))
+		w.SetOutputMirror(o)
+		w.Render()
+	}
+}
+
+// Ports policy of each audited proxy and the number of proxies allowing each port.
+func procPortAudit(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	audited := []*client.Result{}
+	portSet := map[int]bool{}
+	for _, r := range results {
+		if r.Ports.Allowed == nil {
+			continue
+		}
+		audited = append(audited, r)
+		for _, ports := range []client.IntList{r.Ports.Allowed, r.Ports.Denied, r.Ports.Failed} {
+			for _, port := range ports {
+				portSet[port] = true
+			}
+		}
+	}
+	if len(audited) == 0 {
+		return nil
+	}
+	ports := maps.Keys(portSet)
+	slices.Sort(ports)
+	headers := table.Row{"proxy"}
+	colAllowed := NewTableCountable("Allowed ports"+tblSuffix, outputs)
+	for _, port := range ports {
+		headers = append(headers, port)
+		colAllowed.DistinctCntr[strconv.Itoa(port)] = 0
+	}
+	tblPolicy := NewTableMatrix("Port policy"+tblSuffix, outputs, headers)
+	for _, r := range audited {
+		policy := map[int]string{}
+		for _, port := range r.Ports.Allowed {
+			policy[port] = "allowed"
+			colAllowed.add(strconv.Itoa(port))
+		}
+		for _, port := range r.Ports.Denied {
+			policy[port] = "denied"
+		}
+		for _, port := range r.Ports.Failed {
+			policy[port] = "failed"
+		}
+		row := table.Row{r.ProxyURL.Redacted()}
+		for _, port := range ports {
+			row = append(row, policy[port])
+		}
+		tblPolicy.addRow(row)
+	}
+	// percents are calculated against the number of audited proxies
+	colAllowed.TotalCnt = len(audited)
+	tblPolicy.PrintTable()
+	colAllowed.PrintTable()
+	return []ProxyChickStatTable{tblPolicy, colAllowed}
+}
+
+// Pass/fail report of the SSRF audit: outcome of each destination per proxy, as tunnel/forward for HTTP(S) proxies.
+// Proxy fails if it reached any destination, and errors if it didn't answer for some of them.
+func procSSRFAudit(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	proxies := []string{}
+	targets := []string{}
+	outcomes := map[string]map[string]string{}
+	verdicts := map[string]string{}
+	for _, r := range results {
+		if r.SSRF.Tunnel == "" {
+			continue
+		}
+		proxy, target := r.ProxyURL.Redacted(), r.TargetURL.Host
+		if _, ok := outcomes[proxy]; !ok {
+			proxies = append(proxies, proxy)
+			outcomes[proxy] = map[string]string{}
+			verdicts[proxy] = "pass"
+		}
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+		outcome := r.SSRF.Tunnel
+		if r.SSRF.Forward != "" {
+			outcome += "/" + r.SSRF.Forward
+		}
+		switch {
+		case !r.Status:
+			outcome = "error"
+			if verdicts[proxy] == "pass" {
+				verdicts[proxy] = "error"
+			}
+		case !r.Valid:
+			verdicts[proxy] = "fail"
+		}
+		outcomes[proxy][target] = outcome
+	}
+	if len(proxies) == 0 {
+		return nil
+	}
+	slices.Sort(targets)
+	headers := table.Row{"proxy"}
+	for _, target := range targets {
+		headers = append(headers, target)
+	}
+	headers = append(headers, "verdict")
+	tblExposure := NewTableMatrix("SSRF exposure"+tblSuffix, outputs, headers)
+	colVerdict := NewTableCountable("SSRF verdict"+tblSuffix, outputs)
+	for _, proxy := range proxies {
+		row := table.Row{proxy}
+		for _, target := range targets {
+			row = append(row, outcomes[proxy][target])
+		}
+		tblExposure.addRow(append(row, verdicts[proxy]))
+		colVerdict.add(verdicts[proxy])
+	}
+	tblExposure.PrintTable()
+	colVerdict.PrintTable()
+	return []ProxyChickStatTable{tblExposure, colVerdict}
+}
+
+// Share of the checks each validation rule failed. One response can fail several rules, so percents are calculated against the number of requests.
+func procValidation(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colValidation := NewTableCountable("Validation"+tblSuffix, outputs)
+	unreachableCnt := 0
+	for _, r := range results {
+		if !r.Status {
+			unreachableCnt++
+		}
+		if r.ValidationErrors == nil {
+			continue
+		}
+		for _, category := range r.ValidationErrors {
+			colValidation.add(category)
+		}
+		if r.Valid {
+			colValidation.add("ok")
+		}
+	}
+	if colValidation.TotalCnt == 0 {
+		return nil
+	}
+	if unreachableCnt > 0 {
+		colValidation.DistinctCntr["unreachable"] = unreachableCnt
+	}
+	colValidation.TotalCnt = len(results)
+	colValidation.PrintTable()
+	return []ProxyChickStatTable{colValidation}
+}
+
+// Block labels of the target responses and the rules that matched.
+func procBlocks(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colBlock := NewTableCountable("Block rate"+tblSuffix, outputs)
+	colBlockRule := NewTableCountable("Block rules"+tblSuffix, outputs)
+	for _, r := range results {
+		if r.BlockStatus == "" {
+			continue
+		}
+		colBlock.add(r.BlockStatus)
+		if r.BlockRule != "" {
+			colBlockRule.add(r.BlockRule)
+		}
+	}
+	if colBlock.TotalCnt == 0 {
+		return nil
+	}
+	colBlock.PrintTable()
+	if colBlockRule.TotalCnt == 0 {
+		return []ProxyChickStatTable{colBlock}
+	}
+	colBlockRule.PrintTable()
+	return []ProxyChickStatTable{colBlock, colBlockRule}
+}
+
+// Redirect chain lengths and the hosts the successful chains ended at.
+func procRedirects(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colRedirects := NewTableCountable("Redirect chain length"+tblSuffix, outputs)
+	colFinalHost := NewTableCountable("Redirect final hosts"+tblSuffix, outputs)
+	for _, r := range results {
+		if r.RedirectChain == nil {
+			continue
+		}
+		colRedirects.add(strconv.Itoa(r.RedirectCnt))
+		if r.Status {
+			colFinalHost.add(r.RedirectChain[len(r.RedirectChain)-1].URL.Host)
+		}
+	}
+	if colRedirects.TotalCnt == 0 {
+		return nil
+	}
+	colRedirects.PrintTable()
+	if colFinalHost.TotalCnt == 0 {
+		return []ProxyChickStatTable{colRedirects}
+	}
+	colFinalHost.PrintTable()
+	return []ProxyChickStatTable{colRedirects, colFinalHost}
+}
+
+// Protocols detected with -p auto. One proxy can speak several protocols, so percents are calculated against the number of proxies.
+func procDetected(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colDetected := NewTableCountable("Detected protocols"+tblSuffix, outputs)
+	detectedCnt := 0
+	for _, r := range results {
+		if r.DetectedProtocols == nil {
+			continue
+		}
+		detectedCnt++
+		for _, proto := range r.DetectedProtocols {
+			colDetected.add(proto)
+		}
+		if len(r.DetectedProtocols) == 0 {
+			colDetected.add("none")
+		}
+	}
+	if detectedCnt == 0 {
+		return nil
+	}
+	colDetected.TotalCnt = detectedCnt
+	colDetected.PrintTable()
+	return []ProxyChickStatTable{colDetected}
+}
+
+// Connection reuse, exit IP rotation and cold vs warm TTFB of the keep-alive mode.
+func procKeepAlive(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colReuse := NewTableCountable("Connection reuse"+tblSuffix, outputs)
+	colIPRotation := NewTableCountable("Exit IP mid-connection"+tblSuffix, outputs)
+	kaCold := NewColumnMesurable("Cold TTFB")
+	kaWarm := NewColumnMesurable("Warm TTFB")
+	for _, r := range results {
+		if r.KeepAlive.WarmTTFB == nil {
+			// not keep-alive mode or the first request failed
+			continue
+		}
+		kaCold.Vals = append(kaCold.Vals, float64(r.Latency.TTFB))
+		for _, ttfb := range r.KeepAlive.WarmTTFB {
+			kaWarm.Vals = append(kaWarm.Vals, float64(ttfb))
+			colReuse.add("reused")
+		}
+		for i := 0; i < r.KeepAlive.Reconnects; i++ {
+			colReuse.add("reconnected")
+		}
+		if r.Error.Err != nil {
+			colReuse.add("failed")
+		}
+		if r.KeepAlive.ExitIPChanges > 0 {
+			colIPRotation.add("rotated")
+		} else {
+			colIPRotation.add("stable")
+		}
+	}
+	if kaCold.Vals == nil {
+		return nil
+	}
+	colReuse.PrintTable()
+	colIPRotation.PrintTable()
+	tblKeepAlive := NewTableMesurable("Keep-alive latency"+tblSuffix, outputs, []*ColumnMesurable{kaCold, kaWarm})
+	tblKeepAlive.PrintTable()
+	return []ProxyChickStatTable{colReuse, colIPRotation, tblKeepAlive}
+}
+
+// Loss buckets and quality metrics of the UDP stream mode.
+func procUDPStream(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colUDPLoss := NewTableCountable("UDP loss"+tblSuffix, outputs)
+	udpLoss := NewColumnMesurable("Loss %")
+	udpJitter := NewColumnMesurable("Jitter ms")
+	udpRTT := NewColumnMesurable("RTT avg ms")
+	udpReordered := NewColumnMesurable("Reordered")
+	udpDuplicates := NewColumnMesurable("Duplicates")
+	for _, r := range results {
+		if r.UDP.Sent == 0 {
+			continue
+		}
+		udpLoss.Vals = append(udpLoss.Vals, r.UDP.Loss)
+		udpReordered.Vals = append(udpReordered.Vals, float64(r.UDP.Reordered))
+		udpDuplicates.Vals = append(udpDuplicates.Vals, float64(r.UDP.Duplicates))
+		if r.UDP.Received > 0 {
+			udpJitter.Vals = append(udpJitter.Vals, r.UDP.Jitter)
+			udpRTT.Vals = append(udpRTT.Vals, r.UDP.RTTAvg)
+		}
+		switch {
+		case r.UDP.Loss == 0:
+			colUDPLoss.add("none")
+		case r.UDP.Loss < 1:
+			colUDPLoss.add("<1%")
+		case r.UDP.Loss <= 5:
+			colUDPLoss.add("1-5%")
+		default:
+			colUDPLoss.add(">5%")
+		}
+	}
+	if colUDPLoss.TotalCnt == 0 {
+		return nil
+	}
+	colUDPLoss.PrintTable()
+	tblUDP := NewTableMesurable("UDP quality"+tblSuffix, outputs, []*ColumnMesurable{udpLoss, udpJitter, udpRTT, udpReordered, udpDuplicates})
+	tblUDP.PrintTable()
+	return []ProxyChickStatTable{colUDPLoss, tblUDP}
+}
+
+// Largest datagrams found by the UDP MTU search.
+func procUDPMTU(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	udpMaxSize := NewColumnMesurable("Max datagram bytes")
+	for _, r := range results {
+		if r.UDPMTU.MaxSize > 0 {
+			udpMaxSize.Vals = append(udpMaxSize.Vals, float64(r.UDPMTU.MaxSize))
+		}
+	}
+	if udpMaxSize.Vals == nil {
+		return nil
+	}
+	tblUDPMTU := NewTableMesurable("UDP datagram size"+tblSuffix, outputs, []*ColumnMesurable{udpMaxSize})
+	tblUDPMTU.PrintTable()
+	return []ProxyChickStatTable{tblUDPMTU}
+}
+
+// Outcome of each UDP probe type and the clock offsets NTP servers reported.
+func procUDPProbe(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colUDPProbe := NewTableCountable("UDP probe"+tblSuffix, outputs)
+	ntpOffset := NewColumnMesurable("Clock offset ms")
+	for _, r := range results {
+		if r.UDPProbe.Type == "" {
+			continue
+		}
+		if r.Status {
+			colUDPProbe.add(r.UDPProbe.Type + ": ok")
+		} else {
+			colUDPProbe.add(r.UDPProbe.Type + ": failed")
+		}
+		if r.Status && r.UDPProbe.Type == client.UDPProbeNTP {
+			ntpOffset.Vals = append(ntpOffset.Vals, float64(r.UDPProbe.ClockOffset))
+		}
+	}
+	if colUDPProbe.TotalCnt == 0 {
+		return nil
+	}
+	colUDPProbe.PrintTable()
+	if ntpOffset.Vals == nil {
+		return []ProxyChickStatTable{colUDPProbe}
+	}
+	tblNTP := NewTableMesurable("NTP"+tblSuffix, outputs, []*ColumnMesurable{ntpOffset})
+	tblNTP.PrintTable()
+	return []ProxyChickStatTable{colUDPProbe, tblNTP}
+}
+
+// Schedule lag of the open model. Raw TTFB hides the time the test waited for maxInFlight slot, corrected one doesn't.
+func procOpenModel(results []*client.Result, outputs []io.Writer, jobMetrics *job.JobMetrics, tblSuffix string) []ProxyChickStatTable {
+	if jobMetrics.TargetRPS <= 0 || len(results) == 0 {
+		return nil
+	}
+	latTTFB := NewColumnMesurable("TTFB")
+	loadTTFB := NewColumnMesurable("Corrected TTFB")
+	loadLag := NewColumnMesurable("Schedule lag")
+	for _, r := range results {
+		loadLag.Vals = append(loadLag.Vals, float64(r.Load.Lag))
+		if r.Status {
+			latTTFB.Vals = append(latTTFB.Vals, float64(r.Latency.TTFB))
+			loadTTFB.Vals = append(loadTTFB.Vals, float64(r.Load.TTFB))
+		}
+	}
+	tblLoad := NewTableMesurable("Open model latency"+tblSuffix, outputs, []*ColumnMesurable{latTTFB, loadTTFB, loadLag})
+	tblLoad.PrintTable()
+	return []ProxyChickStatTable{tblLoad}
+}
+
+// Outcome of the retried tests and the errors their failed attempts ended with. Flaky proxies succeed only after retries.
+func procRetries(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colRetry := NewTableCountable("Retry outcome"+tblSuffix, outputs)
+	colAttemptErr := NewTableCountable("Failed attempts"+tblSuffix, outputs)
+	for _, r := range results {
+		if len(r.Attempts) == 0 {
+			continue
+		}
+		if !r.Status {
+			colRetry.add("failed")
+		} else if len(r.Attempts) == 1 {
+			colRetry.add("ok on first try")
+		} else {
+			colRetry.add("ok after retries")
+		}
+		for _, a := range r.Attempts {
+			if a.Category != "" {
+				colAttemptErr.add(a.Category)
+			}
+		}
+	}
+	if colRetry.TotalCnt == 0 {
+		return nil
+	}
+	colRetry.PrintTable()
+	if colAttemptErr.TotalCnt == 0 {
+		return []ProxyChickStatTable{colRetry}
+	}
+	colAttemptErr.PrintTable()
+	return []ProxyChickStatTable{colRetry, colAttemptErr}
+}
+
+// Whether the proxies with credentials enforce them and how they reject missing and wrong ones.
+func procAuth(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colAuth := NewTableCountable("Auth enforcement"+tblSuffix, outputs)
+	colAuthReject := NewTableCountable("Auth rejection"+tblSuffix, outputs)
+	for _, r := range results {
+		if r.Auth.NoCreds == "" {
+			// proxy without credentials wasn't probed
+			continue
+		}
+		if r.Auth.Open {
+			colAuth.add("open")
+		} else {
+			colAuth.add("enforced")
+		}
+		colAuthReject.add("no creds: " + r.Auth.NoCreds)
+		colAuthReject.add("wrong creds: " + r.Auth.WrongCreds)
+	}
+	if colAuth.TotalCnt == 0 {
+		return nil
+	}
+	colAuth.PrintTable()
+	colAuthReject.PrintTable()
+	return []ProxyChickStatTable{colAuth, colAuthReject}
+}
+
+// Drop reasons, lifetime and heartbeat RTT of the established tunnels.
+func procTunnel(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	colTunnelDrop := NewTableCountable("Tunnel drops"+tblSuffix, outputs)
+	tunLifetime := NewColumnMesurable("Lifetime")
+	tunHeartbeat := NewColumnMesurable("Heartbeat RTT")
+	for _, r := range results {
+		if r.Tunnel.Heartbeats == nil {
+			// tunnel wasn't established
+			continue
+		}
+		tunLifetime.Vals = append(tunLifetime.Vals, float64(r.Tunnel.Lifetime))
+		for _, rtt := range r.Tunnel.Heartbeats {
+			tunHeartbeat.Vals = append(tunHeartbeat.Vals, float64(rtt))
+		}
+		if r.Tunnel.Drop == "" {
+			colTunnelDrop.add("survived")
+		} else {
+			colTunnelDrop.add(r.Tunnel.Drop)
+		}
+	}
+	if colTunnelDrop.TotalCnt == 0 {
+		return nil
+	}
+	colTunnelDrop.PrintTable()
+	tblTunnel := NewTableMesurable("Tunnel ms"+tblSuffix, outputs, []*ColumnMesurable{tunLifetime, tunHeartbeat})
+	tblTunnel.PrintTable()
+	return []ProxyChickStatTable{colTunnelDrop, tblTunnel}
+}
+
+// Download and upload rates and volumes of the successful bandwidth tests.
+func procThroughput(results []*client.Result, outputs []io.Writer, tblSuffix string) []ProxyChickStatTable {
+	thrDownAvg := NewColumnMesurable("Download avg")
+	thrDownPeak := NewColumnMesurable("Download peak")
+	thrUpAvg := NewColumnMesurable("Upload avg")
+	thrUpPeak := NewColumnMesurable("Upload peak")
+	volDown := NewColumnMesurable("Downloaded")
+	volUp := NewColumnMesurable("Uploaded")
+	for _, r := range results {
+		if !r.Status || r.Throughput.BytesDown == 0 {
+			continue
+		}
+		thrDownAvg.Vals = append(thrDownAvg.Vals, float64(r.Throughput.DownAvg))
+		thrDownPeak.Vals = append(thrDownPeak.Vals, float64(r.Throughput.DownPeak))
+		volDown.Vals = append(volDown.Vals, float64(r.Throughput.BytesDown/1024))
+		if r.Throughput.BytesUp > 0 {
+			thrUpAvg.Vals = append(thrUpAvg.Vals, float64(r.Throughput.UpAvg))
+			thrUpPeak.Vals = append(thrUpPeak.Vals, float64(r.Throughput.UpPeak))
+			volUp.Vals = append(volUp.Vals, float64(r.Throughput.BytesUp/1024))
+		}
+	}
+	if len(thrDownAvg.Vals) == 0 {
+		return nil
+	}
+	throughputMetrics := []*ColumnMesurable{thrDownAvg, thrDownPeak}
+	volumeMetrics := []*ColumnMesurable{volDown}
+	if len(thrUpAvg.Vals) > 0 {
+		throughputMetrics = append(throughputMetrics, thrUpAvg, thrUpPeak)
+		volumeMetrics = append(volumeMetrics, volUp)
+	}
+	tblThroughput := NewTableMesurable("Throughput KB/s"+tblSuffix, outputs, throughputMetrics)
+	tblThroughput.PrintTable()
+	tblVolume := NewTableMesurable("Transferred KB"+tblSuffix, outputs, volumeMetrics)
+	tblVolume.PrintTable()
+	return []ProxyChickStatTable{tblThroughput, tblVolume}
+}
+
 type IPGeo struct {
 	CountryName string
 	CountryISO  string
 }
 
 func ProcTestResults(results []*client.Result, outputs []io.Writer, trasnport string, jobMetrics *job.JobMetrics) []ProxyChickStatTable {
+	return procTestResults(results, outputs, trasnport, jobMetrics, "")
+}
+
+// Build and print the stat tables for results, tblSuffix is appended to each table name.
+// Tables of the optional features are built by procX helpers and skipped when no result has the feature data.
+func procTestResults(results []*client.Result, outputs []io.Writer, trasnport string, jobMetrics *job.JobMetrics, tblSuffix string) []ProxyChickStatTable {
 	rv := []ProxyChickStatTable{}
-	var colSucc, colErr, colTgtStatus, colPrxStatus, tblLatency ProxyChickStatTable
+	var colSucc, colErr, colTgtStatus, colPrxStatus, colSOCKSReply, tblLatency ProxyChickStatTable
 	var measurableMetrics []*ColumnMesurable
 	var containsHTTPscheme = false
-	colSucc = NewTableCountable("Success Rate", outputs)
-	colErr = NewTableCountable("Errors", outputs)
-	colTgtStatus = NewTableCountable("Taget HTTP status codes", outputs)
-	colPrxStatus = NewTableCountable("Proxy HTTP status codes", outputs)
+	colSucc = NewTableCountable("Success Rate"+tblSuffix, outputs)
+	colErr = NewTableCountable("Errors"+tblSuffix, outputs)
+	colTgtStatus = NewTableCountable("Taget HTTP status codes"+tblSuffix, outputs)
+	colPrxStatus = NewTableCountable("Proxy HTTP status codes"+tblSuffix, outputs)
+	colSOCKSReply = NewTableCountable("Proxy SOCKS reply codes"+tblSuffix, outputs)
 
 	latTTFB := NewColumnMesurable("TTFB")
 	latDNS := NewColumnMesurable("DNS resolve")
 	latConnect := NewColumnMesurable("Connect")
 	latPrxResp := NewColumnMesurable("ProxyResp")
 	latTLS := NewColumnMesurable("TLSHandshake")
+	latPrxTLS := NewColumnMesurable("ProxyTLSHandshake")
+	var containsHTTPSscheme = false
+	var containsSOCKSscheme = false
+	latSOCKSGreeting := NewColumnMesurable("SOCKSGreeting")
+	latSOCKSAuth := NewColumnMesurable("SOCKSAuth")
+	latTTLB := NewColumnMesurable("TTLB")
 	uniqueIP := map[string]bool{}
 	for _, r := range results {
 		if strings.HasPrefix(r.ProxyURL.String(), "http") {
 			containsHTTPscheme = true
 		}
+		if r.ProxyURL.Scheme == "https" {
+			containsHTTPSscheme = true
+		}
+		if client.IsSOCKS(&r.ProxyURL.URL) {
+			containsSOCKSscheme = true
+		}
 		if r.Status {
 			colSucc.add("ok")
 			colErr.add("ok")
@@ -212,10 +752,26 @@ func ProcTestResults(results []*client.Result, outputs []io.Writer, trasnport st
 				latDNS.Vals = append(latDNS.Vals, float64(r.Latency.DNSresolve))
 				latConnect.Vals = append(latConnect.Vals, float64(r.Latency.Connect))
 				latTLS.Vals = append(latTLS.Vals, float64(r.Latency.TLSHandshake))
+				if r.ProxyURL.Scheme == "https" {
+					latPrxTLS.Vals = append(latPrxTLS.Vals, float64(r.Latency.ProxyTLSHandshake))
+				}
+				if client.IsSOCKS(&r.ProxyURL.URL) {
+					latSOCKSGreeting.Vals = append(latSOCKSGreeting.Vals, float64(r.Latency.SOCKSGreeting))
+					latSOCKSAuth.Vals = append(latSOCKSAuth.Vals, float64(r.Latency.SOCKSAuth))
+				}
+			} else {
+				// control connection and handshake of SOCKS5 UDP association
+				latConnect.Vals = append(latConnect.Vals, float64(r.Latency.Connect))
+				latSOCKSGreeting.Vals = append(latSOCKSGreeting.Vals, float64(r.Latency.SOCKSGreeting))
+				latSOCKSAuth.Vals = append(latSOCKSAuth.Vals, float64(r.Latency.SOCKSAuth))
 			}
 			// these metrics works for both transport protocols TCP and UDP
 			latTTFB.Vals = append(latTTFB.Vals, float64(r.Latency.TTFB))
 			latPrxResp.Vals = append(latPrxResp.Vals, float64(r.Latency.ProxyResp))
+			if r.Throughput.BytesDown > 0 {
+				// bandwidth mode
+				latTTLB.Vals = append(latTTLB.Vals, float64(r.Latency.TTLB))
+			}
 			uniqueIP[r.ProxyNodeIPAddr.String()] = true
 		} else {
 			colSucc.add("error")
@@ -223,13 +779,23 @@ func ProcTestResults(results []*client.Result, outputs []io.Writer, trasnport st
 			colErr.add(errNorm)
 		}
 		if trasnport == "tcp" {
-			colTgtStatus.add(strconv.Itoa(r.TargetStatusCode))
+			if r.TargetURL.Scheme == "http" || r.TargetURL.Scheme == "https" {
+				colTgtStatus.add(strconv.Itoa(r.TargetStatusCode))
+			}
 			colPrxStatus.add(strconv.Itoa(r.ProxyStatusCode))
 		}
+		if client.IsSOCKS(&r.ProxyURL.URL) {
+			// CONNECT reply for TCP and UDP ASSOCIATE one for UDP
+			colSOCKSReply.add(r.ProxySOCKSReply)
+		}
 	}
 	colSucc.PrintTable()
 	colErr.PrintTable()
 	rv = append(rv, colSucc, colErr)
+	rv = append(rv, procValidation(results, outputs, tblSuffix)...)
+	rv = append(rv, procBlocks(results, outputs, tblSuffix)...)
+	rv = append(rv, procRedirects(results, outputs, tblSuffix)...)
+	rv = append(rv, procDetected(results, outputs, tblSuffix)...)
 	jobMetrics.UniqueExitNodesIPCnt = len(uniqueIP)
 	reqRespCounters := colSucc.getCounters()
 	jobMetrics.RespCnt = reqRespCounters["ok"]
@@ -239,20 +805,49 @@ func ProcTestResults(results []*client.Result, outputs []io.Writer, trasnport st
 	measurableMetrics = []*ColumnMesurable{latTTFB}
 	if trasnport == "tcp" {
 		measurableMetrics = append(measurableMetrics, latDNS, latConnect, latTLS)
-		colTgtStatus.PrintTable()
-		rv = append(rv, colTgtStatus)
+		if len(colTgtStatus.getCounters()) > 0 {
+			colTgtStatus.PrintTable()
+			rv = append(rv, colTgtStatus)
+		}
 		if containsHTTPscheme {
 			colPrxStatus.PrintTable()
 			rv = append(rv, colPrxStatus)
 			measurableMetrics = append(measurableMetrics, latPrxResp)
 		}
+		if containsHTTPSscheme {
+			measurableMetrics = append(measurableMetrics, latPrxTLS)
+		}
+		if containsSOCKSscheme {
+			colSOCKSReply.PrintTable()
+			rv = append(rv, colSOCKSReply)
+			if !containsHTTPscheme {
+				measurableMetrics = append(measurableMetrics, latPrxResp)
+			}
+			measurableMetrics = append(measurableMetrics, latSOCKSGreeting, latSOCKSAuth)
+		}
 	}
 	if trasnport == "udp" {
-		measurableMetrics = append(measurableMetrics, latPrxResp)
+		measurableMetrics = append(measurableMetrics, latConnect, latPrxResp, latSOCKSGreeting, latSOCKSAuth)
+		colSOCKSReply.PrintTable()
+		rv = append(rv, colSOCKSReply)
+	}
+	if len(latTTLB.Vals) > 0 {
+		measurableMetrics = append(measurableMetrics, latTTLB)
 	}
-	tblLatency = NewTableMesurable("Latency", outputs, measurableMetrics)
+	tblLatency = NewTableMesurable("Latency"+tblSuffix, outputs, measurableMetrics)
 	tblLatency.PrintTable()
 	rv = append(rv, tblLatency)
+	rv = append(rv, procKeepAlive(results, outputs, tblSuffix)...)
+	rv = append(rv, procUDPStream(results, outputs, tblSuffix)...)
+	rv = append(rv, procUDPMTU(results, outputs, tblSuffix)...)
+	rv = append(rv, procUDPProbe(results, outputs, tblSuffix)...)
+	rv = append(rv, procOpenModel(results, outputs, jobMetrics, tblSuffix)...)
+	rv = append(rv, procRetries(results, outputs, tblSuffix)...)
+	rv = append(rv, procAuth(results, outputs, tblSuffix)...)
+	rv = append(rv, procTunnel(results, outputs, tblSuffix)...)
+	rv = append(rv, procPortAudit(results, outputs, tblSuffix)...)
+	rv = append(rv, procSSRFAudit(results, outputs, tblSuffix)...)
+	rv = append(rv, procThroughput(results, outputs, tblSuffix)...)
 	return rv
 }
 
@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"errors"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 )
 
 func SaveSonDisk(fName string, data string) error {
@@ -20,3 +24,53 @@ func SaveSonDisk(fName string, data string) error {
 	}
 	return nil
 }
+
+var sizeUnits = map[string]int64{"": 1, "B": 1, "K": 1 << 10, "KB": 1 << 10, "M": 1 << 20, "MB": 1 << 20, "G": 1 << 30, "GB": 1 << 30}
+
+// Parses size like 512, 64K or 50MB, units are powers of 1024.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	numEnd := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if numEnd == -1 {
+		numEnd = len(s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[numEnd:])]
+	if !ok || numEnd == 0 {
+		return 0, errors.New("Can't parse size: " + size)
+	}
+	n, err := strconv.ParseInt(s[:numEnd], 10, 64)
+	if err != nil {
+		return 0, errors.New("Can't parse size: " + size)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, errors.New("Size is too large: " + size)
+	}
+	return n * unit, nil
+}
+
+// Formats size in powers of 1024, e.g. 1.50MB.
+func FormatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, i := float64(n), 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	return strconv.FormatFloat(size, 'f', 2, 64) + units[i]
+}
+
+// Parses comma separated list of ports like 22,25,443.
+func ParsePorts(ports string) ([]int, error) {
+	rv := []int{}
+	for _, p := range strings.Split(ports, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, errors.New("Can't parse ports: " + ports)
+		}
+		rv = append(rv, port)
+	}
+	return rv, nil
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":                 512,
+		"512B":                512,
+		"64K":                 64 << 10,
+		" 50mb ":              50 << 20,
+		"10 GB":               10 << 30,
+		"8589934591GB":        8589934591 << 30,
+		"9223372036854775807": math.MaxInt64,
+	}
+	for size, want := range cases {
+		if got, err := ParseSize(size); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", size, got, err, want)
+		}
+	}
+}
+
+func TestParseSizeInvalid(t *testing.T) {
+	for _, size := range []string{"", "MB", "10TB", "-1", "1.5MB", "9999999999999GB", "8589934592GB", "99999999999999999999"} {
+		if got, err := ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want error", size, got)
+		}
+	}
+}